@@ -0,0 +1,257 @@
+package main
+
+import (
+	"container/list"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+)
+
+// KeyFunc извлекает из элемента конвейера ключ, по которому определяются дубликаты
+type KeyFunc func(val interface{}) string
+
+func DefaultKey(val interface{}) string {
+	return fmt.Sprintf("%v", val)
+}
+
+// SeenSet запоминает ключи. Seen возвращает true, если ключ уже встречался
+type SeenSet interface {
+	Seen(key string) bool
+}
+
+var now = time.Now
+
+type seenEntry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+// boundedStore - ограниченное по размеру хранилище, при переполнении вытесняются самые старые записи
+type boundedStore struct {
+	mu       sync.Mutex
+	capacity int
+	ttl      time.Duration
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+func newBoundedStore(capacity int, ttl time.Duration) *boundedStore {
+	return &boundedStore{
+		capacity: capacity,
+		ttl:      ttl,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (s *boundedStore) get(key string) (string, bool) {
+	el, ok := s.items[key]
+	if !ok {
+		return "", false
+	}
+
+	entry := el.Value.(*seenEntry)
+	if s.ttl > 0 && now().After(entry.expires) {
+		s.order.Remove(el)
+		delete(s.items, key)
+		return "", false
+	}
+
+	return entry.value, true
+}
+
+func (s *boundedStore) put(key, value string) {
+	if el, ok := s.items[key]; ok {
+		s.order.Remove(el)
+	}
+
+	entry := &seenEntry{key: key, value: value, expires: now().Add(s.ttl)}
+	s.items[key] = s.order.PushBack(entry)
+
+	for s.capacity > 0 && s.order.Len() > s.capacity {
+		oldest := s.order.Front()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(*seenEntry).key)
+	}
+}
+
+// ExactSet хранит ключи точно, но не больше capacity штук. ttl = 0 - ключи не устаревают
+type ExactSet struct {
+	store *boundedStore
+}
+
+func NewExactSet(capacity int, ttl time.Duration) *ExactSet {
+	return &ExactSet{store: newBoundedStore(capacity, ttl)}
+}
+
+func (s *ExactSet) Seen(key string) bool {
+	s.store.mu.Lock()
+	defer s.store.mu.Unlock()
+
+	if _, ok := s.store.get(key); ok {
+		return true
+	}
+	s.store.put(key, "")
+	return false
+}
+
+// BloomSet - фильтр Блума на bits бит и hashes хеш-функций.
+// Возможны ложные срабатывания (уникальный элемент посчитается дубликатом), пропусков дубликатов нет.
+// При ttl > 0 фильтр держит два поколения и раз в ttl сбрасывает старшее
+type BloomSet struct {
+	mu       sync.Mutex
+	hashes   int
+	ttl      time.Duration
+	rotateAt time.Time
+	current  []uint64
+	previous []uint64
+	bits     uint64
+}
+
+func NewBloomSet(bits, hashes int, ttl time.Duration) *BloomSet {
+	if bits < 64 {
+		bits = 64
+	}
+	if hashes < 1 {
+		hashes = 1
+	}
+
+	words := (bits + 63) / 64
+	return &BloomSet{
+		hashes:   hashes,
+		ttl:      ttl,
+		rotateAt: now().Add(ttl),
+		current:  make([]uint64, words),
+		previous: make([]uint64, words),
+		bits:     uint64(words * 64),
+	}
+}
+
+func (s *BloomSet) Seen(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t := now(); s.ttl > 0 && t.After(s.rotateAt) {
+		s.previous, s.current = s.current, s.previous
+		// за время простоя пропущена и следующая ротация - устарело и предыдущее поколение
+		if t.After(s.rotateAt.Add(s.ttl)) {
+			clearBits(s.previous)
+		}
+		clearBits(s.current)
+		s.rotateAt = t.Add(s.ttl)
+	}
+
+	h1, h2 := bloomHashes(key)
+	seen := true
+	for i := 0; i < s.hashes; i++ {
+		pos := (h1 + uint64(i)*h2) % s.bits
+		word, mask := pos/64, uint64(1)<<(pos%64)
+
+		if s.current[word]&mask == 0 && s.previous[word]&mask == 0 {
+			seen = false
+		}
+		s.current[word] |= mask
+	}
+
+	return seen
+}
+
+func clearBits(words []uint64) {
+	for i := range words {
+		words[i] = 0
+	}
+}
+
+func bloomHashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	h1 := h.Sum64()
+
+	h = fnv.New64()
+	h.Write([]byte(key))
+	h2 := h.Sum64() | 1
+
+	return h1, h2
+}
+
+// Dedup отбрасывает элементы, ключ которых уже встречался
+func Dedup(key KeyFunc, seen SeenSet) job {
+	return func(in, out chan interface{}) {
+		for val := range in {
+			if seen.Seen(key(val)) {
+				continue
+			}
+			out <- val
+		}
+	}
+}
+
+// SignatureCache хранит посчитанные подписи и объединяет одновременные запросы одного ключа
+type SignatureCache struct {
+	store    *boundedStore
+	inflight map[string]*pendingSign
+}
+
+type pendingSign struct {
+	done chan struct{}
+	sign string
+}
+
+func NewSignatureCache(capacity int, ttl time.Duration) *SignatureCache {
+	return &SignatureCache{
+		store:    newBoundedStore(capacity, ttl),
+		inflight: make(map[string]*pendingSign),
+	}
+}
+
+func (c *SignatureCache) sign(key string, calc func() string) string {
+	c.store.mu.Lock()
+	if sign, ok := c.store.get(key); ok {
+		c.store.mu.Unlock()
+		return sign
+	}
+	if p, ok := c.inflight[key]; ok {
+		c.store.mu.Unlock()
+		<-p.done
+		return p.sign
+	}
+
+	p := &pendingSign{done: make(chan struct{})}
+	c.inflight[key] = p
+	c.store.mu.Unlock()
+
+	p.sign = calc()
+
+	c.store.mu.Lock()
+	c.store.put(key, p.sign)
+	delete(c.inflight, key)
+	c.store.mu.Unlock()
+	close(p.done)
+
+	return p.sign
+}
+
+// DedupSign заменяет связку SingleHash + MultiHash схемы s: для повторного ключа
+// отдаёт подпись из кеша вместо повторного расчёта. Ключ кеша включает ID схемы,
+// так что один кеш можно делить между схемами
+func DedupSign(s *Scheme, key KeyFunc, cache *SignatureCache) job {
+	return func(in, out chan interface{}) {
+		var wg sync.WaitGroup
+
+		for val := range in {
+			data := fmt.Sprintf("%v", val)
+			wg.Add(1)
+
+			go func(k, data string) {
+				defer wg.Done()
+				out <- cache.sign(k, func() string {
+					return s.multiHash(s.singleHash(data))
+				})
+			}(s.ID()+"|"+key(val), data)
+		}
+
+		wg.Wait()
+	}
+}
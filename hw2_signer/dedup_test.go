@@ -0,0 +1,135 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDedupExactSet(t *testing.T) {
+	var got []interface{}
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, v := range []int{1, 2, 1, 3, 2, 1} {
+				out <- v
+			}
+		}),
+		Dedup(DefaultKey, NewExactSet(10, 0)),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				got = append(got, val)
+			}
+		}),
+	)
+
+	if len(got) != 3 {
+		t.Errorf("expected 3 unique values, got %v", got)
+	}
+}
+
+func TestExactSetCapacityAndTTL(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	s := NewExactSet(2, time.Minute)
+	s.Seen("a")
+	s.Seen("b")
+	s.Seen("c")
+	if s.Seen("a") {
+		t.Errorf("a must be evicted by capacity")
+	}
+
+	current = current.Add(2 * time.Minute)
+	if s.Seen("c") {
+		t.Errorf("c must be expired by ttl")
+	}
+}
+
+func TestBloomSet(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	s := NewBloomSet(1<<16, 4, time.Minute)
+	if s.Seen("a") {
+		t.Errorf("a is not seen yet")
+	}
+	if !s.Seen("a") {
+		t.Errorf("a must be seen")
+	}
+
+	current = current.Add(2 * time.Minute)
+	if !s.Seen("a") {
+		t.Errorf("a must survive one rotation")
+	}
+	current = current.Add(2 * time.Minute)
+	s.Seen("b")
+	current = current.Add(2 * time.Minute)
+	if s.Seen("a") {
+		t.Errorf("a must be forgotten after two rotations")
+	}
+}
+
+func TestBloomSetIdle(t *testing.T) {
+	current := time.Now()
+	now = func() time.Time { return current }
+	defer func() { now = time.Now }()
+
+	s := NewBloomSet(1<<16, 4, time.Minute)
+	s.Seen("a")
+
+	// простой дольше двух ttl: одной ротации мало, забываются оба поколения
+	current = current.Add(time.Hour)
+	if s.Seen("a") {
+		t.Errorf("a must be forgotten after a long idle period")
+	}
+	if !s.Seen("a") {
+		t.Errorf("a must be seen again")
+	}
+}
+
+func TestDedupSignUsesCache(t *testing.T) {
+	var crcCalls uint32
+	origCrc32, origMd5 := DataSignerCrc32, DataSignerMd5
+	defer func() { DataSignerCrc32, DataSignerMd5 = origCrc32, origMd5 }()
+
+	DataSignerMd5 = func(data string) string { return "md5" + data }
+	DataSignerCrc32 = func(data string) string {
+		atomic.AddUint32(&crcCalls, 1)
+		return "crc" + data
+	}
+
+	var signs []string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, v := range []int{0, 1, 0, 1, 0} {
+				out <- v
+			}
+		}),
+		DedupSign(schemeClassic, DefaultKey, NewSignatureCache(10, 0)),
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				signs = append(signs, val.(string))
+			}
+		}),
+	)
+
+	if len(signs) != 5 {
+		t.Fatalf("expected 5 signatures, got %d", len(signs))
+	}
+	// 2 уникальных значения * (2 crc32 в SingleHash + 6 в MultiHash)
+	if crcCalls != 16 {
+		t.Errorf("expected 16 crc32 calls, got %d", crcCalls)
+	}
+	want := schemeClassic.multiHash("crc0~crcmd50")
+	found := 0
+	for _, sign := range signs {
+		if sign == want {
+			found++
+		}
+	}
+	if found != 3 {
+		t.Errorf("expected 3 signatures of 0, got %d in %v", found, signs)
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Протокол между RemoteStage и воркером: кадры вида
+// [тип 1 байт][id 8 байт][длина 4 байта][данные].
+// Клиент шлёт frameHello с именем задачи, воркер отвечает frameReady или frameError.
+// Каждый frameItem подтверждается frameResult с тем же id
+const (
+	frameHello byte = iota + 1
+	frameReady
+	frameItem
+	frameResult
+	frameError
+)
+
+const maxFrameLen = 16 << 20
+
+// maxConnItems ограничивает число элементов, которые воркер считает одновременно для одного соединения
+const maxConnItems = 64
+
+var errUnknownRemoteJob = errors.New("unknown remote job")
+
+type frame struct {
+	kind    byte
+	id      uint64
+	payload []byte
+}
+
+func writeFrame(w io.Writer, f frame) error {
+	var header [13]byte
+	header[0] = f.kind
+	binary.BigEndian.PutUint64(header[1:9], f.id)
+	binary.BigEndian.PutUint32(header[9:13], uint32(len(f.payload)))
+
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := w.Write(f.payload)
+	return err
+}
+
+func readFrame(r io.Reader) (frame, error) {
+	var header [13]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+
+	size := binary.BigEndian.Uint32(header[9:13])
+	if size > maxFrameLen {
+		return frame{}, fmt.Errorf("frame too large: %d bytes", size)
+	}
+
+	f := frame{
+		kind:    header[0],
+		id:      binary.BigEndian.Uint64(header[1:9]),
+		payload: make([]byte, size),
+	}
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+
+	return f, nil
+}
+
+var (
+	remoteJobsMu sync.RWMutex
+	remoteJobs   = map[string]func(data string) string{}
+)
+
+// RegisterRemoteJob делает функцию доступной воркерам под именем name
+func RegisterRemoteJob(name string, fn func(data string) string) {
+	remoteJobsMu.Lock()
+	defer remoteJobsMu.Unlock()
+	remoteJobs[name] = fn
+}
+
+func lookupRemoteJob(name string) (func(data string) string, bool) {
+	remoteJobsMu.RLock()
+	defer remoteJobsMu.RUnlock()
+	fn, ok := remoteJobs[name]
+	return fn, ok
+}
+
+// registerRemoteScheme публикует стадии схемы под именами "SingleHash:<ID>" и "MultiHash:<ID>".
+// Для classic@1 остаются и прежние имена "SingleHash" и "MultiHash"
+func registerRemoteScheme(s *Scheme) {
+	RegisterRemoteJob("SingleHash:"+s.ID(), s.singleHash)
+	RegisterRemoteJob("MultiHash:"+s.ID(), s.multiHash)
+	if s.ID() == schemeClassic.ID() {
+		RegisterRemoteJob("SingleHash", s.singleHash)
+		RegisterRemoteJob("MultiHash", s.multiHash)
+	}
+}
+
+// ServeRemote принимает соединения от RemoteStage и выполняет зарегистрированные задачи
+func ServeRemote(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go handleRemoteConn(conn)
+	}
+}
+
+func handleRemoteConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	hello, err := readFrame(r)
+	if err != nil || hello.kind != frameHello {
+		return
+	}
+
+	fn, ok := lookupRemoteJob(string(hello.payload))
+	if !ok {
+		writeFrame(conn, frame{kind: frameError, payload: []byte(errUnknownRemoteJob.Error())})
+		return
+	}
+
+	var writeMu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	sem := make(chan struct{}, maxConnItems)
+
+	if err := writeFrame(conn, frame{kind: frameReady}); err != nil {
+		return
+	}
+
+	for {
+		f, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		if f.kind != frameItem {
+			continue
+		}
+
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(f frame) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			result := fn(string(f.payload))
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			writeFrame(conn, frame{kind: frameResult, id: f.id, payload: []byte(result)})
+		}(f)
+	}
+}
+
+// RemoteStage пересылает элементы воркерам по TCP.
+// На каждое соединение приходится не больше MaxInFlight неподтверждённых элементов,
+// при обрыве соединение переустанавливается через RetryDelay, а неподтверждённые элементы отправляются заново.
+// Адрес бросается после MaxRetries неудачных попыток подряд (0 - без ограничения) или сразу,
+// если воркер не знает задачу. Попытка считается удачной, только если воркер подтвердил хотя бы один элемент.
+// Когда брошены все адреса, оставшиеся элементы отбрасываются
+// с вызовом OnDrop и стадия завершается
+type RemoteStage struct {
+	Name        string
+	Addrs       []string
+	MaxInFlight int
+	RetryDelay  time.Duration
+	MaxRetries  int
+	Dial        func(addr string) (net.Conn, error)
+	OnDrop      func(data string, err error)
+}
+
+// remoteJobError - воркер ответил frameError на приветствие, переподключение не поможет
+type remoteJobError struct {
+	name, msg string
+}
+
+func (e *remoteJobError) Error() string {
+	return fmt.Sprintf("remote %s: %s", e.name, e.msg)
+}
+
+func NewRemoteStage(name string, addrs ...string) *RemoteStage {
+	return &RemoteStage{
+		Name:        name,
+		Addrs:       addrs,
+		MaxInFlight: 16,
+		RetryDelay:  100 * time.Millisecond,
+		MaxRetries:  50,
+		Dial: func(addr string) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, time.Second)
+		},
+	}
+}
+
+type remoteItem struct {
+	id   uint64
+	data string
+}
+
+func (s *RemoteStage) Stage() job {
+	return func(in, out chan interface{}) {
+		var wg sync.WaitGroup
+		work := make(chan *remoteItem)
+		quit := make(chan struct{})
+		// dead закрывается, когда брошены все адреса
+		dead := make(chan struct{})
+		var lastErr error
+
+		drop := func(item *remoteItem) {
+			if s.OnDrop != nil {
+				s.OnDrop(item.data, lastErr)
+			}
+			wg.Done()
+		}
+		requeue := func(item *remoteItem) {
+			go func() {
+				select {
+				case work <- item:
+				case <-dead:
+					drop(item)
+				}
+			}()
+		}
+		deliver := func(result string) {
+			out <- result
+			wg.Done()
+		}
+
+		var connWg sync.WaitGroup
+		var errMu sync.Mutex
+		for _, addr := range s.Addrs {
+			connWg.Add(1)
+			go func(addr string) {
+				defer connWg.Done()
+				if err := s.connLoop(addr, work, quit, requeue, deliver); err != nil {
+					errMu.Lock()
+					lastErr = fmt.Errorf("%s: %w", addr, err)
+					errMu.Unlock()
+				}
+			}(addr)
+		}
+		go func() {
+			connWg.Wait()
+			close(dead)
+		}()
+
+		var id uint64
+		for val := range in {
+			id++
+			wg.Add(1)
+			item := &remoteItem{id: id, data: fmt.Sprintf("%v", val)}
+			select {
+			case work <- item:
+			case <-dead:
+				drop(item)
+			}
+		}
+
+		wg.Wait()
+		close(quit)
+		<-dead
+	}
+}
+
+// connLoop обслуживает адрес до закрытия quit (возвращает nil) или до отказа от адреса
+func (s *RemoteStage) connLoop(addr string, work <-chan *remoteItem, quit <-chan struct{},
+	requeue func(*remoteItem), deliver func(string)) error {
+	failures := 0
+	for {
+		conn, err := s.Dial(addr)
+		if err == nil {
+			var acked bool
+			acked, err = s.session(conn, work, quit, requeue, deliver)
+			if acked {
+				failures = 0
+			}
+		}
+		if err == nil {
+			return nil
+		}
+
+		var jobErr *remoteJobError
+		if errors.As(err, &jobErr) {
+			return err
+		}
+		failures++
+		if s.MaxRetries > 0 && failures > s.MaxRetries {
+			return fmt.Errorf("giving up after %d attempts: %w", failures, err)
+		}
+
+		select {
+		case <-quit:
+			return nil
+		case <-time.After(s.RetryDelay):
+		}
+	}
+}
+
+// session возвращает acked = true, если воркер подтвердил хотя бы один элемент
+func (s *RemoteStage) session(conn net.Conn, work <-chan *remoteItem, quit <-chan struct{},
+	requeue func(*remoteItem), deliver func(string)) (bool, error) {
+	r := bufio.NewReader(conn)
+
+	if err := writeFrame(conn, frame{kind: frameHello, payload: []byte(s.Name)}); err != nil {
+		conn.Close()
+		return false, err
+	}
+	ready, err := readFrame(r)
+	if err != nil {
+		conn.Close()
+		return false, err
+	}
+	if ready.kind != frameReady {
+		conn.Close()
+		return false, &remoteJobError{name: s.Name, msg: string(ready.payload)}
+	}
+
+	var mu sync.Mutex
+	pending := map[uint64]*remoteItem{}
+	slots := make(chan struct{}, s.MaxInFlight)
+	readerDone := make(chan struct{})
+	var readErr error
+	acked := false
+
+	go func() {
+		defer close(readerDone)
+		for {
+			f, err := readFrame(r)
+			if err != nil {
+				readErr = err
+				return
+			}
+			if f.kind != frameResult {
+				continue
+			}
+
+			mu.Lock()
+			_, ok := pending[f.id]
+			delete(pending, f.id)
+			mu.Unlock()
+
+			if ok {
+				acked = true
+				<-slots
+				deliver(string(f.payload))
+			}
+		}
+	}()
+
+	var sessionErr error
+loop:
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-readerDone:
+			sessionErr = readErr
+			break loop
+		case <-quit:
+			break loop
+		}
+
+		select {
+		case item := <-work:
+			mu.Lock()
+			pending[item.id] = item
+			mu.Unlock()
+
+			err := writeFrame(conn, frame{kind: frameItem, id: item.id, payload: []byte(item.data)})
+			if err != nil {
+				sessionErr = err
+				break loop
+			}
+		case <-readerDone:
+			sessionErr = readErr
+			break loop
+		case <-quit:
+			break loop
+		}
+	}
+
+	conn.Close()
+	<-readerDone
+
+	mu.Lock()
+	for id, item := range pending {
+		delete(pending, id)
+		requeue(item)
+	}
+	mu.Unlock()
+
+	select {
+	case <-quit:
+		return acked, nil
+	default:
+	}
+	if sessionErr == nil {
+		sessionErr = errors.New("remote session closed")
+	}
+	return acked, sessionErr
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func startRemoteWorker(t *testing.T, addr string) net.Listener {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatalf("cant listen: %v", err)
+	}
+	go ServeRemote(ln)
+	return ln
+}
+
+func collectRemote(stage job, values ...string) []string {
+	var results []string
+	ExecutePipeline(
+		job(func(in, out chan interface{}) {
+			for _, v := range values {
+				out <- v
+			}
+		}),
+		stage,
+		job(func(in, out chan interface{}) {
+			for val := range in {
+				results = append(results, val.(string))
+			}
+		}),
+	)
+	sort.Strings(results)
+	return results
+}
+
+func TestRemoteStage(t *testing.T) {
+	RegisterRemoteJob("upper", strings.ToUpper)
+
+	ln1 := startRemoteWorker(t, "127.0.0.1:0")
+	defer ln1.Close()
+	ln2 := startRemoteWorker(t, "127.0.0.1:0")
+	defer ln2.Close()
+
+	stage := NewRemoteStage("upper", ln1.Addr().String(), ln2.Addr().String())
+	stage.MaxInFlight = 2
+
+	got := collectRemote(stage.Stage(), "a", "b", "c", "d", "e")
+	if strings.Join(got, "") != "ABCDE" {
+		t.Errorf("unexpected results %v", got)
+	}
+}
+
+func TestRemoteStageReconnect(t *testing.T) {
+	RegisterRemoteJob("upper", strings.ToUpper)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cant listen: %v", err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		ln := startRemoteWorker(t, addr)
+		time.Sleep(2 * time.Second)
+		ln.Close()
+	}()
+
+	stage := NewRemoteStage("upper", addr)
+	stage.RetryDelay = 20 * time.Millisecond
+
+	got := collectRemote(stage.Stage(), "x", "y")
+	if strings.Join(got, "") != "XY" {
+		t.Errorf("unexpected results %v", got)
+	}
+}
+
+func TestRemoteStageGivesUp(t *testing.T) {
+	ln := startRemoteWorker(t, "127.0.0.1:0")
+	defer ln.Close()
+
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cant listen: %v", err)
+	}
+	deadAddr := closed.Addr().String()
+	closed.Close()
+
+	// воркер принимает задачу и сразу рвёт соединение
+	flaky, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cant listen: %v", err)
+	}
+	defer flaky.Close()
+	go func() {
+		for {
+			conn, err := flaky.Accept()
+			if err != nil {
+				return
+			}
+			if _, err := readFrame(conn); err == nil {
+				writeFrame(conn, frame{kind: frameReady})
+			}
+			conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		name  string
+		stage *RemoteStage
+	}{
+		{"unknown job", NewRemoteStage("no-such-job", ln.Addr().String())},
+		{"dead worker", NewRemoteStage("upper", deadAddr)},
+		{"flaky worker", NewRemoteStage("upper", flaky.Addr().String())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var dropped []string
+			tt.stage.RetryDelay = 10 * time.Millisecond
+			tt.stage.MaxRetries = 2
+			tt.stage.OnDrop = func(data string, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if err == nil {
+					t.Errorf("%s dropped without error", data)
+				}
+				dropped = append(dropped, data)
+			}
+
+			done := make(chan []string)
+			go func() { done <- collectRemote(tt.stage.Stage(), "a", "b") }()
+			select {
+			case got := <-done:
+				if len(got) != 0 || len(dropped) != 2 {
+					t.Errorf("expected all items dropped, got %v, dropped %v", got, dropped)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("stage did not finish")
+			}
+		})
+	}
+}
+
+func TestRemoteFrameRoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go writeFrame(client, frame{kind: frameItem, id: 42, payload: []byte("data")})
+
+	f, err := readFrame(server)
+	if err != nil {
+		t.Fatalf("cant read frame: %v", err)
+	}
+	if f.kind != frameItem || f.id != 42 || string(f.payload) != "data" {
+		t.Errorf("unexpected frame %+v", f)
+	}
+}
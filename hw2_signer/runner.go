@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	StatusOK           = 0
+	StatusDrainTimeout = 1
+	StatusAborted      = 2
+)
+
+// Runner запускает конвейер и перехватывает SIGINT/SIGTERM.
+// По сигналу закрывается in источника - это просьба остановиться, после неё источник
+// должен вернуться. Уже принятые элементы дорабатывают оставшиеся стадии (включая CombineResults)
+// в течение GracePeriod. Повторный сигнал прерывает ожидание сразу
+type Runner struct {
+	GracePeriod time.Duration
+	Signals     []os.Signal
+}
+
+func NewRunner(gracePeriod time.Duration) *Runner {
+	return &Runner{
+		GracePeriod: gracePeriod,
+		Signals:     []os.Signal{syscall.SIGINT, syscall.SIGTERM},
+	}
+}
+
+// Run возвращает код завершения: StatusOK, если источник и все стадии завершились,
+// StatusDrainTimeout, если не уложились в GracePeriod, StatusAborted при повторном сигнале.
+// Горутины нельзя прервать снаружи, поэтому при StatusDrainTimeout и StatusAborted
+// незавершённые источник и стадии бросаются - Run рассчитан на то, что после него процесс выходит
+func (r *Runner) Run(source job, jobs ...job) int {
+	sigCh := make(chan os.Signal, 2)
+	signal.Notify(sigCh, r.Signals...)
+	defer signal.Stop(sigCh)
+
+	stop := make(chan struct{})
+	srcIn, srcOut := make(chan interface{}), make(chan interface{})
+	stagesIn := make(chan interface{})
+
+	go func() {
+		source(srcIn, srcOut)
+		close(srcOut)
+	}()
+
+	gated := make(chan struct{})
+	go func() {
+		gate(stop, srcOut, stagesIn)
+		close(gated)
+	}()
+
+	stages := runStages(stagesIn, jobs...)
+	done := make(chan struct{})
+	go func() {
+		<-gated
+		<-stages
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return StatusOK
+	case <-sigCh:
+		close(stop)
+		close(srcIn)
+	}
+
+	timer := time.NewTimer(r.GracePeriod)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+		return StatusOK
+	case <-timer.C:
+		return StatusDrainTimeout
+	case <-sigCh:
+		return StatusAborted
+	}
+}
+
+// gate передаёт элементы источника стадиям, пока не закрыт stop. После этого
+// стадиям закрывается вход, а остаток источника вычитывается вхолостую, пока источник
+// не завершится, чтобы он не завис на записи
+func gate(stop <-chan struct{}, in <-chan interface{}, out chan<- interface{}) {
+	defer func() {
+		for range in {
+		}
+	}()
+	defer close(out)
+
+	for {
+		select {
+		case <-stop:
+			return
+		case val, ok := <-in:
+			if !ok {
+				return
+			}
+			select {
+			case out <- val:
+			case <-stop:
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// endlessSource пишет, пока Runner не закроет in
+func endlessSource(in, out chan interface{}) {
+	for i := 0; ; i++ {
+		select {
+		case out <- i:
+		case <-in:
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func slowStage(delay time.Duration) job {
+	return func(in, out chan interface{}) {
+		for val := range in {
+			time.Sleep(delay)
+			out <- val
+		}
+	}
+}
+
+func sendSignalAfter(t *testing.T, d time.Duration) {
+	go func() {
+		time.Sleep(d)
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGTERM); err != nil {
+			t.Errorf("cant send signal: %v", err)
+		}
+	}()
+}
+
+func TestRunnerDrainsOnSignal(t *testing.T) {
+	var processed, combined, stopped uint32
+	sendSignalAfter(t, 50*time.Millisecond)
+
+	status := NewRunner(time.Second).Run(
+		func(in, out chan interface{}) {
+			endlessSource(in, out)
+			atomic.StoreUint32(&stopped, 1)
+		},
+		slowStage(10*time.Millisecond),
+		job(func(in, out chan interface{}) {
+			for range in {
+				atomic.AddUint32(&processed, 1)
+			}
+			atomic.StoreUint32(&combined, 1)
+		}),
+	)
+
+	if status != StatusOK {
+		t.Errorf("expected StatusOK, got %d", status)
+	}
+	if processed == 0 || combined == 0 || stopped == 0 {
+		t.Errorf("pipeline was not drained: processed %d, combined %d, source stopped %d", processed, combined, stopped)
+	}
+}
+
+func TestRunnerDrainTimeout(t *testing.T) {
+	sendSignalAfter(t, 20*time.Millisecond)
+
+	status := NewRunner(50*time.Millisecond).Run(
+		endlessSource,
+		slowStage(time.Second),
+		job(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	)
+
+	if status != StatusDrainTimeout {
+		t.Errorf("expected StatusDrainTimeout, got %d", status)
+	}
+}
+
+func TestRunnerWaitsForSource(t *testing.T) {
+	sendSignalAfter(t, 20*time.Millisecond)
+
+	// источник не слушает in: стадии слились, но Run ждёт его до конца GracePeriod
+	status := NewRunner(50*time.Millisecond).Run(
+		func(in, out chan interface{}) {
+			for i := 0; ; i++ {
+				out <- i
+				time.Sleep(5 * time.Millisecond)
+			}
+		},
+		job(func(in, out chan interface{}) {
+			for range in {
+			}
+		}),
+	)
+
+	if status != StatusDrainTimeout {
+		t.Errorf("expected StatusDrainTimeout, got %d", status)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	HashMd5   = "md5"
+	HashCrc32 = "crc32"
+)
+
+// Scheme описывает раскладку подписи.
+// SingleParts - части результата SingleHash, каждая часть - цепочка хешей, применяемых к данным по очереди
+// (например {md5, crc32} = crc32(md5(data))). Части склеиваются через SingleSep.
+// MultiChain применяется к th+data для каждого th из [0, FanOut), результаты склеиваются через MultiSep.
+// CombineResults склеивает отсортированные результаты через CombineSep.
+// Схема однозначно задаётся парой Name + Version. Реестр хранит копию схемы и отдаёт копии,
+// поэтому изменить зарегистрированную схему нельзя
+type Scheme struct {
+	Name        string
+	Version     int
+	SingleParts [][]string
+	SingleSep   string
+	FanOut      int
+	MultiChain  []string
+	MultiSep    string
+	CombineSep  string
+}
+
+var schemeClassic = &Scheme{
+	Name:        "classic",
+	Version:     1,
+	SingleParts: [][]string{{HashCrc32}, {HashMd5, HashCrc32}},
+	SingleSep:   "~",
+	FanOut:      6,
+	MultiChain:  []string{HashCrc32},
+	MultiSep:    "",
+	CombineSep:  "_",
+}
+
+var schemeLayered = &Scheme{
+	Name:        "layered",
+	Version:     1,
+	SingleParts: [][]string{{HashCrc32}, {HashMd5, HashCrc32}, {HashMd5}},
+	SingleSep:   "~",
+	FanOut:      8,
+	MultiChain:  []string{HashMd5, HashCrc32},
+	MultiSep:    ":",
+	CombineSep:  "_",
+}
+
+var (
+	schemesMu sync.RWMutex
+	schemes   = map[string]*Scheme{}
+)
+
+// DataSignerMd5 нельзя вызывать параллельно ни в одной стадии, поэтому мьютекс общий для всех схем и стадий
+var md5Mutex sync.Mutex
+
+func init() {
+	for _, s := range []*Scheme{schemeClassic, schemeLayered} {
+		if err := RegisterScheme(s); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func (s *Scheme) clone() *Scheme {
+	c := *s
+	c.SingleParts = make([][]string, len(s.SingleParts))
+	for i, chain := range s.SingleParts {
+		c.SingleParts[i] = append([]string(nil), chain...)
+	}
+	c.MultiChain = append([]string(nil), s.MultiChain...)
+	return &c
+}
+
+func (s *Scheme) ID() string {
+	return s.Name + "@" + strconv.Itoa(s.Version)
+}
+
+func (s *Scheme) Validate() error {
+	if s.Name == "" || strings.Contains(s.Name, "@") {
+		return fmt.Errorf("bad scheme name %q", s.Name)
+	}
+	if s.Version < 1 {
+		return fmt.Errorf("scheme %s: version must be >= 1", s.Name)
+	}
+	if len(s.SingleParts) == 0 {
+		return fmt.Errorf("scheme %s: no single hash parts", s.ID())
+	}
+	if s.FanOut < 1 {
+		return fmt.Errorf("scheme %s: fan-out must be >= 1", s.ID())
+	}
+
+	chains := append([][]string{s.MultiChain}, s.SingleParts...)
+	for _, chain := range chains {
+		if len(chain) == 0 {
+			return fmt.Errorf("scheme %s: empty hash chain", s.ID())
+		}
+		for _, name := range chain {
+			if name != HashMd5 && name != HashCrc32 {
+				return fmt.Errorf("scheme %s: unknown hash %s", s.ID(), name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// RegisterScheme добавляет схему в реестр. Повторная регистрация того же ID запрещена,
+// чтобы подписи, посчитанные старой версией, оставались воспроизводимыми
+func RegisterScheme(s *Scheme) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+
+	schemesMu.Lock()
+	defer schemesMu.Unlock()
+
+	if _, ok := schemes[s.ID()]; ok {
+		return fmt.Errorf("scheme %s already registered", s.ID())
+	}
+	schemes[s.ID()] = s.clone()
+	registerRemoteScheme(s.clone())
+	return nil
+}
+
+// LookupScheme ищет схему по ID вида "name@version" или по имени - тогда берётся последняя версия
+func LookupScheme(id string) (*Scheme, error) {
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+
+	if s, ok := schemes[id]; ok {
+		return s.clone(), nil
+	}
+
+	var latest *Scheme
+	for _, s := range schemes {
+		if s.Name == id && (latest == nil || s.Version > latest.Version) {
+			latest = s
+		}
+	}
+	if latest == nil {
+		return nil, fmt.Errorf("unknown scheme %s", id)
+	}
+	return latest.clone(), nil
+}
+
+func SchemeIDs() []string {
+	schemesMu.RLock()
+	defer schemesMu.RUnlock()
+
+	ids := make([]string, 0, len(schemes))
+	for id := range schemes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *Scheme) applyChain(chain []string, data string) string {
+	for _, name := range chain {
+		switch name {
+		case HashMd5:
+			md5Mutex.Lock()
+			data = DataSignerMd5(data)
+			md5Mutex.Unlock()
+		case HashCrc32:
+			data = DataSignerCrc32(data)
+		}
+	}
+	return data
+}
+
+func (s *Scheme) singleHash(data string) string {
+	results := make([]string, len(s.SingleParts))
+	var wg sync.WaitGroup
+	wg.Add(len(s.SingleParts))
+
+	for i, chain := range s.SingleParts {
+		go func(i int, chain []string) {
+			defer wg.Done()
+			results[i] = s.applyChain(chain, data)
+		}(i, chain)
+	}
+
+	wg.Wait()
+	return strings.Join(results, s.SingleSep)
+}
+
+func (s *Scheme) multiHash(data string) string {
+	results := make([]string, s.FanOut)
+	var wg sync.WaitGroup
+	wg.Add(s.FanOut)
+
+	for i := 0; i < s.FanOut; i++ {
+		go func(i int) {
+			defer wg.Done()
+			results[i] = s.applyChain(s.MultiChain, strconv.Itoa(i)+data)
+		}(i)
+	}
+
+	wg.Wait()
+	return strings.Join(results, s.MultiSep)
+}
+
+func (s *Scheme) SingleHash() job {
+	return func(in, out chan interface{}) {
+		var wg sync.WaitGroup
+
+		for val := range in {
+			data := fmt.Sprintf("%v", val)
+			wg.Add(1)
+
+			go func(data string) {
+				defer wg.Done()
+				out <- s.singleHash(data)
+			}(data)
+		}
+
+		wg.Wait()
+	}
+}
+
+func (s *Scheme) MultiHash() job {
+	return func(in, out chan interface{}) {
+		var wg sync.WaitGroup
+
+		for val := range in {
+			data := fmt.Sprintf("%v", val)
+			wg.Add(1)
+
+			go func(data string) {
+				defer wg.Done()
+				out <- s.multiHash(data)
+			}(data)
+		}
+
+		wg.Wait()
+	}
+}
+
+func (s *Scheme) CombineResults() job {
+	return func(in, out chan interface{}) {
+		var results []string
+
+		for val := range in {
+			results = append(results, val.(string))
+		}
+
+		sort.Strings(results)
+		out <- strings.Join(results, s.CombineSep)
+	}
+}
+
+// Jobs возвращает стадии SingleHash, MultiHash и CombineResults этой схемы
+func (s *Scheme) Jobs() []job {
+	return []job{s.SingleHash(), s.MultiHash(), s.CombineResults()}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func withFakeSigners(t *testing.T) {
+	origCrc32, origMd5 := DataSignerCrc32, DataSignerMd5
+	t.Cleanup(func() { DataSignerCrc32, DataSignerMd5 = origCrc32, origMd5 })
+
+	DataSignerMd5 = func(data string) string { return "m(" + data + ")" }
+	DataSignerCrc32 = func(data string) string { return "c(" + data + ")" }
+}
+
+func TestSchemeClassicLayout(t *testing.T) {
+	withFakeSigners(t)
+
+	var result string
+	ExecutePipeline(append(append([]job{
+		job(func(in, out chan interface{}) {
+			out <- 1
+		}),
+	}, schemeClassic.Jobs()...), job(func(in, out chan interface{}) {
+		result = (<-in).(string)
+	}))...)
+
+	single := "c(1)~c(m(1))"
+	expected := ""
+	for _, th := range []string{"0", "1", "2", "3", "4", "5"} {
+		expected += "c(" + th + single + ")"
+	}
+	if result != expected {
+		t.Errorf("classic scheme changed:\nGot:\n%v\nExpected:\n%v", result, expected)
+	}
+}
+
+func TestSchemeLayered(t *testing.T) {
+	withFakeSigners(t)
+
+	s, err := LookupScheme("layered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	multi := s.multiHash(s.singleHash("x"))
+	parts := strings.Split(multi, ":")
+	if len(parts) != 8 {
+		t.Fatalf("expected fan-out 8, got %d parts", len(parts))
+	}
+	if parts[0] != "c(m(0c(x)~c(m(x))~m(x)))" {
+		t.Errorf("unexpected layered part %s", parts[0])
+	}
+}
+
+func TestRegisterScheme(t *testing.T) {
+	if err := RegisterScheme(schemeClassic); err == nil {
+		t.Errorf("expected error on duplicate registration")
+	}
+	if err := RegisterScheme(&Scheme{Name: "bad", Version: 1, FanOut: 1, SingleParts: [][]string{{"sha1"}}, MultiChain: []string{HashCrc32}}); err == nil {
+		t.Errorf("expected error on unknown hash")
+	}
+
+	s, err := LookupScheme("classic@1")
+	if err != nil || s.ID() != schemeClassic.ID() || s == schemeClassic {
+		t.Errorf("cant lookup a copy of classic@1: %v", err)
+	}
+
+	// ни найденная, ни исходная схема не меняют зарегистрированную
+	custom := &Scheme{Name: "custom", Version: 1, FanOut: 1, SingleParts: [][]string{{HashCrc32}}, MultiChain: []string{HashCrc32}}
+	if err := RegisterScheme(custom); err != nil {
+		t.Fatal(err)
+	}
+	custom.FanOut = 2
+	custom.SingleParts[0][0] = HashMd5
+	s.MultiChain[0] = HashMd5
+
+	if s, _ := LookupScheme("custom"); s.FanOut != 1 || s.SingleParts[0][0] != HashCrc32 {
+		t.Errorf("registered scheme changed: %+v", s)
+	}
+	if s, _ := LookupScheme("classic"); s.MultiChain[0] != HashCrc32 {
+		t.Errorf("registered scheme changed: %+v", s)
+	}
+}
+
+func TestSchemeLayeredMd5NotConcurrent(t *testing.T) {
+	withFakeSigners(t)
+
+	var active, overlaps int32
+	DataSignerMd5 = func(data string) string {
+		if atomic.AddInt32(&active, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&active, -1)
+		return "m(" + data + ")"
+	}
+
+	s, err := LookupScheme("layered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ExecutePipeline(append([]job{
+		job(func(in, out chan interface{}) {
+			for i := 0; i < 10; i++ {
+				out <- i
+			}
+		}),
+	}, append(s.Jobs(), job(func(in, out chan interface{}) {
+		<-in
+	}))...)...)
+
+	if overlaps != 0 {
+		t.Errorf("DataSignerMd5 called concurrently %d times", overlaps)
+	}
+}
+
+func TestSchemeRemoteJobs(t *testing.T) {
+	withFakeSigners(t)
+
+	s, err := LookupScheme("layered")
+	if err != nil {
+		t.Fatal(err)
+	}
+	single, ok := lookupRemoteJob("SingleHash:" + s.ID())
+	if !ok || single("x") != s.singleHash("x") {
+		t.Errorf("remote SingleHash does not use scheme %s", s.ID())
+	}
+	multi, ok := lookupRemoteJob("MultiHash:" + s.ID())
+	if !ok || multi("x") != s.multiHash("x") {
+		t.Errorf("remote MultiHash does not use scheme %s", s.ID())
+	}
+	if classic, ok := lookupRemoteJob("MultiHash"); !ok || classic("x") != schemeClassic.multiHash("x") {
+		t.Errorf("remote MultiHash must stay classic")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+// ahoCorasick ищет сразу все подстроки за один проход по строке.
+// Автомат построен как полный DFA: переход для каждой пары (состояние, класс байта),
+// байты, не встречающиеся в шаблонах, объединены в класс 0, поэтому таблица небольшая.
+// Выход состояния - номера шаблонов, заканчивающихся в нём, с учётом суффиксных ссылок.
+// После построения next хранит не номера состояний, а их смещения в next (номер * nclasses)
+type ahoCorasick struct {
+	classes  [256]uint8
+	nclasses int
+	next     []int32
+	out      [][]int
+}
+
+// newAhoCorasick строит автомат по шаблонам, ids[i] - номер, который выдаётся при нахождении patterns[i].
+// Одинаковые шаблоны с разными номерами допустимы
+func newAhoCorasick(patterns []string, ids []int) *ahoCorasick {
+	ac := &ahoCorasick{nclasses: 1}
+	for _, p := range patterns {
+		for i := 0; i < len(p); i++ {
+			if ac.classes[p[i]] == 0 {
+				ac.classes[p[i]] = uint8(ac.nclasses)
+				ac.nclasses++
+			}
+		}
+	}
+
+	// бор: -1 - перехода нет
+	ac.next = make([]int32, ac.nclasses)
+	ac.out = [][]int{nil}
+	for i := range ac.next {
+		ac.next[i] = -1
+	}
+	for pi, p := range patterns {
+		state := 0
+		for i := 0; i < len(p); i++ {
+			cell := state*ac.nclasses + int(ac.classes[p[i]])
+			if ac.next[cell] < 0 {
+				ac.next[cell] = int32(len(ac.out))
+				ac.out = append(ac.out, nil)
+				for c := 0; c < ac.nclasses; c++ {
+					ac.next = append(ac.next, -1)
+				}
+			}
+			state = int(ac.next[cell])
+		}
+		ac.out[state] = append(ac.out[state], ids[pi])
+	}
+
+	// обход в ширину: недостающие переходы берутся из состояния по суффиксной ссылке,
+	// выходы суффиксной ссылки добавляются к своим
+	fail := make([]int, len(ac.out))
+	queue := make([]int, 0, len(ac.out))
+	for c := 0; c < ac.nclasses; c++ {
+		if child := ac.next[c]; child > 0 {
+			queue = append(queue, int(child))
+		} else {
+			ac.next[c] = 0
+		}
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+		ac.out[state] = append(ac.out[state], ac.out[fail[state]]...)
+
+		for c := 0; c < ac.nclasses; c++ {
+			cell := state*ac.nclasses + c
+			child := ac.next[cell]
+			fallback := ac.next[fail[state]*ac.nclasses+c]
+			if child < 0 {
+				ac.next[cell] = fallback
+				continue
+			}
+			fail[child] = int(fallback)
+			queue = append(queue, int(child))
+		}
+	}
+
+	// номер состояния в смещение, выходы по смещению, чтобы в цикле поиска не было умножения
+	out := make([][]int, len(ac.next))
+	for state, ids := range ac.out {
+		out[state*ac.nclasses] = ids
+	}
+	for i := range ac.next {
+		ac.next[i] *= int32(ac.nclasses)
+	}
+	ac.out = out
+
+	return ac
+}
+
+// match отмечает в hits номера всех шаблонов, встречающихся в s, и возвращает true, если нашёлся хоть один
+func (ac *ahoCorasick) match(s string, hits []bool) bool {
+	found := false
+	for _, id := range ac.out[0] {
+		hits[id] = true
+		found = true
+	}
+
+	next, out := ac.next, ac.out
+	var state int32
+	for i := 0; i < len(s); i++ {
+		state = next[state+int32(ac.classes[s[i]])]
+		if ids := out[state]; len(ids) > 0 {
+			for _, id := range ids {
+				hits[id] = true
+			}
+			found = true
+		}
+	}
+	return found
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestAhoCorasick(t *testing.T) {
+	patterns := []string{"he", "she", "his", "hers", "", "she", "x"}
+	ids := []int{0, 1, 2, 3, 4, 5, 6}
+	ac := newAhoCorasick(patterns, ids)
+
+	r := rand.New(rand.NewSource(1))
+	for n := 0; n < 2000; n++ {
+		buf := make([]byte, r.Intn(12))
+		for i := range buf {
+			buf[i] = "hersix"[r.Intn(6)]
+		}
+		s := string(buf)
+
+		hits := make([]bool, len(patterns))
+		found := ac.match(s, hits)
+		any := false
+		for i, p := range patterns {
+			want := strings.Contains(s, p)
+			any = any || want
+			if hits[i] != want {
+				t.Fatalf("%q: pattern %q hit %v, expected %v", s, p, hits[i], want)
+			}
+		}
+		if found != any {
+			t.Fatalf("%q: found %v, expected %v", s, found, any)
+		}
+	}
+}
+
+// manyKeywordsQuery - запрос с десятками подстрок, как в отчётах по семействам браузеров
+func manyKeywordsQuery() *Query {
+	keywords := []string{"Android", "MSIE", "Opera", "Firefox", "Chrome", "Safari", "iPad", "iPhone", "Windows NT",
+		"Linux", "Macintosh", "BlackBerry", "Nokia", "Symbian", "Kindle", "Silk", "Trident", "Gecko", "Presto",
+		"WebKit", "Mobile", "Fennec", "SeaMonkey", "Konqueror", "Epiphany", "Midori", "Lynx", "Wget", "curl", "bot"}
+
+	terms := make([]string, len(keywords))
+	for i, kw := range keywords {
+		terms[i] = `browser~"` + kw + `"`
+	}
+	return MustCompileQuery(strings.Join(terms, " OR "))
+}
+
+func TestManyKeywordsMatch(t *testing.T) {
+	q := manyKeywordsQuery()
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := q.NewMatcher()
+	var user User
+	for i, line := range strings.Split(string(data), "\n") {
+		if err := user.DecodeJSON([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+		m.Match(&user, nil)
+
+		var expected []string
+		for _, browser := range user.Browsers {
+			for _, term := range q.browsers {
+				if term.match(browser) {
+					expected = append(expected, browser)
+					break
+				}
+			}
+		}
+		if strings.Join(m.MatchedBrowsers(), "\n") != strings.Join(expected, "\n") {
+			t.Fatalf("line %d: matched %q, expected %q", i+1, m.MatchedBrowsers(), expected)
+		}
+	}
+}
+
+func benchmarkBrowsers(b *testing.B) []string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var browsers []string
+	var user User
+	for _, line := range strings.Split(string(data), "\n") {
+		user.DecodeJSON([]byte(line))
+		browsers = append(browsers, user.Browsers...)
+	}
+	return browsers
+}
+
+// go test -bench Keywords -benchmem: автомат против strings.Contains по каждому условию
+func BenchmarkManyKeywordsAhoCorasick(b *testing.B) {
+	q := manyKeywordsQuery()
+	browsers := benchmarkBrowsers(b)
+	hits := make([]bool, len(q.browsers))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, browser := range browsers {
+			q.matchBrowser(browser, hits)
+		}
+	}
+}
+
+func BenchmarkManyKeywordsContains(b *testing.B) {
+	q := manyKeywordsQuery()
+	browsers := benchmarkBrowsers(b)
+	hits := make([]bool, len(q.browsers))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, browser := range browsers {
+			for j, term := range q.browsers {
+				if term.match(browser) {
+					hits[j] = true
+				}
+			}
+		}
+	}
+}
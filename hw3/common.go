@@ -11,17 +11,19 @@ import (
 	// "log"
 )
 
-const filePath string = "./data/users.txt"
+// filePath - файл для SlowSearch и FastSearch, переменная, чтобы бенчмарки могли подставить сгенерированный файл
+var filePath = "./data/users.txt"
 
-func SlowSearch(out io.Writer) {
+func SlowSearch(out io.Writer) error {
 	file, err := os.Open(filePath)
 	if err != nil {
-		panic(err)
+		return err
 	}
+	defer file.Close()
 
 	fileContents, err := ioutil.ReadAll(file)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	r := regexp.MustCompile("@")
@@ -32,14 +34,16 @@ func SlowSearch(out io.Writer) {
 	lines := strings.Split(string(fileContents), "\n")
 
 	users := make([]map[string]interface{}, 0)
-	for _, line := range lines {
+	var offset int64
+	for i, line := range lines {
 		user := make(map[string]interface{})
 		// fmt.Printf("%v %v\n", err, line)
 		err := json.Unmarshal([]byte(line), &user)
 		if err != nil {
-			panic(err)
+			return &LineError{Source: filePath, Line: i + 1, Offset: offset, Err: err}
 		}
 		users = append(users, user)
+		offset += int64(len(line)) + 1
 	}
 
 	for i, user := range users {
@@ -108,4 +112,5 @@ func SlowSearch(out io.Writer) {
 
 	fmt.Fprintln(out, "found users:\n"+foundUsers)
 	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers))
+	return nil
 }
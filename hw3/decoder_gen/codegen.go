@@ -0,0 +1,728 @@
+package main
+
+// генерирует для структур с меткой // jsongen:decoder метод DecodeJSON без рефлексии
+// go build -o ./decoder_gen.exe decoder_gen/* && ./decoder_gen.exe user.go user_decoder.go
+// Общий для всех декодеров лексер пишется отдельно в json_lexer.go рядом с destination_file,
+// поэтому декодеры нескольких файлов одного пакета не конфликтуют
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+var labelPattern = regexp.MustCompile(`^\/\/\s*jsongen:decoder\s*$`)
+
+type Field struct {
+	Name     string
+	JSONName string
+	Type     string
+}
+
+type Decoder struct {
+	StructName string
+	Fields     []Field
+}
+
+var supportedTypes = map[string]bool{
+	"string":   true,
+	"int":      true,
+	"int64":    true,
+	"float64":  true,
+	"bool":     true,
+	"[]string": true,
+}
+
+var (
+	decoderTmpl = template.Must(template.New("decoderTmpl").Parse(`
+// {{.StructName}}Fields - набор полей {{.StructName}}, по биту на поле
+type {{.StructName}}Fields uint64
+
+const (
+{{- range $i, $f := .Fields}}
+{{- if eq $i 0}}
+	{{$.StructName}}Field{{$f.Name}} {{$.StructName}}Fields = 1 << iota
+{{- else}}
+	{{$.StructName}}Field{{$f.Name}}
+{{- end}}
+{{- end}}
+
+	{{.StructName}}AllFields = {{range $i, $f := .Fields}}{{if $i}} | {{end}}{{$.StructName}}Field{{$f.Name}}{{end}}
+)
+
+// {{.StructName}}FieldsByName - поля по именам из json-тегов
+var {{.StructName}}FieldsByName = map[string]{{.StructName}}Fields{
+{{- range .Fields}}
+	"{{.JSONName}}": {{$.StructName}}Field{{.Name}},
+{{- end}}
+}
+
+// DecodeJSON разбирает JSON-объект в {{.StructName}}. Неизвестные поля пропускаются без аллокаций,
+// память слайсов переиспользуется между вызовами
+func (out *{{.StructName}}) DecodeJSON(data []byte) error {
+	return out.DecodeJSONFields(data, {{.StructName}}AllFields)
+}
+
+// DecodeJSONFields - DecodeJSON, разбирающий только поля из fields. Остальные пропускаются
+// без аллокаций, как неизвестные, и остаются нулевыми
+func (out *{{.StructName}}) DecodeJSONFields(data []byte, fields {{.StructName}}Fields) error {
+	return out.decodeJSON(jsonLexer{data: data}, fields)
+}
+
+// DecodeJSONFieldsBorrow - DecodeJSONFields без копирования строк: строки без escape-последовательностей
+// ссылаются прямо на data и действительны, пока data не изменится. Строки, которые нужны дольше, надо копировать
+func (out *{{.StructName}}) DecodeJSONFieldsBorrow(data []byte, fields {{.StructName}}Fields) error {
+	return out.decodeJSON(jsonLexer{data: data, borrow: true}, fields)
+}
+
+func (out *{{.StructName}}) decodeJSON(l jsonLexer, fields {{.StructName}}Fields) error {
+{{- range .Fields}}
+{{- if eq .Type "[]string"}}
+	out.{{.Name}} = out.{{.Name}}[:0]
+{{- else if eq .Type "string"}}
+	out.{{.Name}} = ""
+{{- else if eq .Type "bool"}}
+	out.{{.Name}} = false
+{{- else}}
+	out.{{.Name}} = 0
+{{- end}}
+{{- end}}
+
+	l.skipWS()
+	if !l.consume('{') {
+		return l.fail("expected {")
+	}
+	l.skipWS()
+	if l.consume('}') {
+		return l.trailing()
+	}
+
+	for {
+		key, ok := l.readKey()
+		if !ok {
+			return l.err
+		}
+		l.skipWS()
+		if !l.consume(':') {
+			return l.fail("expected :")
+		}
+		l.skipWS()
+
+		// null оставляет нулевое значение
+		if !l.consumeNull() {
+			switch string(key) {
+{{- range .Fields}}
+			case "{{.JSONName}}":
+				if fields&{{$.StructName}}Field{{.Name}} == 0 {
+					l.skipValue()
+					break
+				}
+{{- if eq .Type "string"}}
+				out.{{.Name}} = l.readString()
+{{- else if eq .Type "[]string"}}
+				out.{{.Name}} = l.readStringSlice(out.{{.Name}})
+{{- else if eq .Type "int"}}
+				out.{{.Name}} = int(l.readInt())
+{{- else if eq .Type "int64"}}
+				out.{{.Name}} = l.readInt()
+{{- else if eq .Type "float64"}}
+				out.{{.Name}} = l.readFloat()
+{{- else if eq .Type "bool"}}
+				out.{{.Name}} = l.readBool()
+{{- end}}
+{{- end}}
+			default:
+				l.skipValue()
+			}
+		}
+		if l.err != nil {
+			return l.err
+		}
+
+		l.skipWS()
+		if l.consume(',') {
+			l.skipWS()
+			continue
+		}
+		if l.consume('}') {
+			return l.trailing()
+		}
+		return l.fail("expected , or }")
+	}
+}
+`))
+
+	lexerTmpl = `
+type jsonLexer struct {
+	data []byte
+	pos  int
+	err  error
+	// borrow - строки без escape-последовательностей не копируются, а ссылаются на data
+	borrow bool
+	depth  int
+}
+
+// maxSkipDepth - предел вложенности пропускаемых значений, как в encoding/json
+const maxSkipDepth = 10000
+
+func (l *jsonLexer) fail(msg string) error {
+	if l.err == nil {
+		l.err = fmt.Errorf("json: %s at offset %d", msg, l.pos)
+	}
+	return l.err
+}
+
+func (l *jsonLexer) skipWS() {
+	for l.pos < len(l.data) {
+		switch l.data[l.pos] {
+		case ' ', '\t', '\r', '\n':
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (l *jsonLexer) consume(c byte) bool {
+	if l.pos < len(l.data) && l.data[l.pos] == c {
+		l.pos++
+		return true
+	}
+	return false
+}
+
+func (l *jsonLexer) consumeNull() bool {
+	if bytes.HasPrefix(l.data[l.pos:], []byte("null")) {
+		l.pos += 4
+		return true
+	}
+	return false
+}
+
+func (l *jsonLexer) trailing() error {
+	l.skipWS()
+	if l.pos != len(l.data) {
+		return l.fail("unexpected data after object")
+	}
+	return nil
+}
+
+// rawString возвращает содержимое строки без кавычек как срез исходных данных
+// и признак того, что его надо декодировать: в нём есть escape-последовательности или невалидный UTF-8.
+// Управляющие символы и неизвестные escape-последовательности - ошибка, как в encoding/json
+func (l *jsonLexer) rawString() ([]byte, bool) {
+	if !l.consume('"') {
+		l.fail("expected string")
+		return nil, false
+	}
+
+	start, decode := l.pos, false
+	for l.pos < len(l.data) {
+		switch c := l.data[l.pos]; {
+		case c == '"':
+			raw := l.data[start:l.pos]
+			l.pos++
+			return raw, decode
+		case c == '\\':
+			decode = true
+			if !l.skipEscape() {
+				return nil, false
+			}
+		case c < 0x20:
+			l.fail("control character in string")
+			return nil, false
+		case c < utf8.RuneSelf:
+			l.pos++
+		default:
+			r, size := utf8.DecodeRune(l.data[l.pos:])
+			if r == utf8.RuneError && size == 1 {
+				decode = true
+			}
+			l.pos += size
+		}
+	}
+
+	l.fail("unterminated string")
+	return nil, false
+}
+
+// skipEscape проверяет escape-последовательность, начинающуюся с \ в l.pos, и пропускает её
+func (l *jsonLexer) skipEscape() bool {
+	if l.pos+1 >= len(l.data) {
+		l.fail("unterminated string")
+		return false
+	}
+
+	switch l.data[l.pos+1] {
+	case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+		l.pos += 2
+		return true
+	case 'u':
+		if l.pos+6 <= len(l.data) && isHex(l.data[l.pos+2:l.pos+6]) {
+			l.pos += 6
+			return true
+		}
+		l.fail("bad unicode escape")
+		return false
+	}
+	l.fail("bad escape")
+	return false
+}
+
+func isHex(s []byte) bool {
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func (l *jsonLexer) readKey() ([]byte, bool) {
+	raw, escaped := l.rawString()
+	if l.err != nil {
+		return nil, false
+	}
+	if escaped {
+		return []byte(l.unescape(raw)), true
+	}
+	return raw, true
+}
+
+func (l *jsonLexer) readString() string {
+	raw, escaped := l.rawString()
+	if l.err != nil {
+		return ""
+	}
+	if escaped {
+		return l.unescape(raw)
+	}
+	if l.borrow && len(raw) > 0 {
+		return *(*string)(unsafe.Pointer(&raw))
+	}
+	return string(raw)
+}
+
+func (l *jsonLexer) unescape(raw []byte) string {
+	buf := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		if c >= utf8.RuneSelf {
+			// невалидный UTF-8 заменяется на U+FFFD, как в encoding/json
+			r, size := utf8.DecodeRune(raw[i:])
+			if r == utf8.RuneError && size == 1 {
+				buf = append(buf, string(utf8.RuneError)...)
+			} else {
+				buf = append(buf, raw[i:i+size]...)
+			}
+			i += size - 1
+			continue
+		}
+		if c != '\\' {
+			buf = append(buf, c)
+			continue
+		}
+
+		i++
+		if i >= len(raw) {
+			l.fail("bad escape")
+			return ""
+		}
+		switch raw[i] {
+		case '"', '\\', '/':
+			buf = append(buf, raw[i])
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r, n := decodeEscapedRune(raw[i+1:])
+			if n == 0 {
+				l.fail("bad unicode escape")
+				return ""
+			}
+			var encoded [utf8.UTFMax]byte
+			buf = append(buf, encoded[:utf8.EncodeRune(encoded[:], r)]...)
+			i += n
+		default:
+			l.fail("bad escape")
+			return ""
+		}
+	}
+	return string(buf)
+}
+
+// decodeEscapedRune разбирает XXXX после \u (и вторую половину суррогатной пары, если есть)
+func decodeEscapedRune(s []byte) (rune, int) {
+	if len(s) < 4 {
+		return 0, 0
+	}
+	v, err := strconv.ParseUint(string(s[:4]), 16, 32)
+	if err != nil {
+		return 0, 0
+	}
+
+	r := rune(v)
+	if utf16.IsSurrogate(r) && len(s) >= 10 && s[4] == '\\' && s[5] == 'u' {
+		low, err := strconv.ParseUint(string(s[6:10]), 16, 32)
+		if err == nil {
+			if pair := utf16.DecodeRune(r, rune(low)); pair != utf8.RuneError {
+				return pair, 10
+			}
+		}
+	}
+	return r, 4
+}
+
+func (l *jsonLexer) readStringSlice(dst []string) []string {
+	dst = dst[:0]
+	if !l.consume('[') {
+		l.fail("expected [")
+		return dst
+	}
+	l.skipWS()
+	if l.consume(']') {
+		return dst
+	}
+
+	for {
+		l.skipWS()
+		// null в массиве даёт пустую строку, как в encoding/json
+		if l.consumeNull() {
+			dst = append(dst, "")
+		} else {
+			dst = append(dst, l.readString())
+		}
+		if l.err != nil {
+			return dst
+		}
+		l.skipWS()
+		if l.consume(',') {
+			continue
+		}
+		if l.consume(']') {
+			return dst
+		}
+		l.fail("expected , or ]")
+		return dst
+	}
+}
+
+// number разбирает число по грамматике JSON: -?(0|[1-9][0-9]*)(.[0-9]+)?([eE][+-]?[0-9]+)?
+// и возвращает nil, если число записано неправильно
+func (l *jsonLexer) number() []byte {
+	start := l.pos
+	l.consume('-')
+	if !l.consume('0') && l.digits() == 0 {
+		return nil
+	}
+	if l.consume('.') && l.digits() == 0 {
+		return nil
+	}
+	if l.consume('e') || l.consume('E') {
+		if !l.consume('+') {
+			l.consume('-')
+		}
+		if l.digits() == 0 {
+			return nil
+		}
+	}
+	return l.data[start:l.pos]
+}
+
+func (l *jsonLexer) digits() int {
+	start := l.pos
+	for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+		l.pos++
+	}
+	return l.pos - start
+}
+
+func (l *jsonLexer) readInt() int64 {
+	raw := l.number()
+	if len(raw) == 0 {
+		l.fail("expected number")
+		return 0
+	}
+
+	var v int64
+	neg := raw[0] == '-'
+	if neg {
+		raw = raw[1:]
+	}
+	for _, c := range raw {
+		if c < '0' || c > '9' {
+			l.fail("expected integer")
+			return 0
+		}
+		v = v*10 + int64(c-'0')
+	}
+	if neg {
+		v = -v
+	}
+	return v
+}
+
+func (l *jsonLexer) readFloat() float64 {
+	v, err := strconv.ParseFloat(string(l.number()), 64)
+	if err != nil {
+		l.fail("expected number")
+	}
+	return v
+}
+
+func (l *jsonLexer) readBool() bool {
+	switch {
+	case bytes.HasPrefix(l.data[l.pos:], []byte("true")):
+		l.pos += 4
+		return true
+	case bytes.HasPrefix(l.data[l.pos:], []byte("false")):
+		l.pos += 5
+		return false
+	}
+	l.fail("expected bool")
+	return false
+}
+
+// skipValue пропускает любое значение, ничего не аллоцируя.
+// Значение проверяется так же строго, как в encoding/json, чтобы обе реализации
+// одинаково решали, какая строка файла испорчена
+func (l *jsonLexer) skipValue() {
+	if l.pos >= len(l.data) {
+		l.fail("unexpected end of data")
+		return
+	}
+
+	switch c := l.data[l.pos]; {
+	case c == '"':
+		l.rawString()
+	case c == '{', c == '[':
+		if l.depth++; l.depth > maxSkipDepth {
+			l.fail("exceeded max depth")
+			return
+		}
+		if c == '{' {
+			l.skipObject()
+		} else {
+			l.skipArray()
+		}
+		l.depth--
+	case c == 't', c == 'f':
+		l.readBool()
+	case c == 'n':
+		if !l.consumeNull() {
+			l.fail("unexpected value")
+		}
+	default:
+		if len(l.number()) == 0 {
+			l.fail("unexpected value")
+		}
+	}
+}
+
+func (l *jsonLexer) skipObject() {
+	l.pos++
+	l.skipWS()
+	if l.consume('}') {
+		return
+	}
+
+	for {
+		l.skipWS()
+		l.rawString()
+		if l.err != nil {
+			return
+		}
+		l.skipWS()
+		if !l.consume(':') {
+			l.fail("expected :")
+			return
+		}
+		l.skipWS()
+		l.skipValue()
+		if l.err != nil {
+			return
+		}
+		l.skipWS()
+		if l.consume(',') {
+			continue
+		}
+		if l.consume('}') {
+			return
+		}
+		l.fail("expected , or }")
+		return
+	}
+}
+
+func (l *jsonLexer) skipArray() {
+	l.pos++
+	l.skipWS()
+	if l.consume(']') {
+		return
+	}
+
+	for {
+		l.skipWS()
+		l.skipValue()
+		if l.err != nil {
+			return
+		}
+		l.skipWS()
+		if l.consume(',') {
+			continue
+		}
+		if l.consume(']') {
+			return
+		}
+		l.fail("expected , or ]")
+		return
+	}
+}
+`
+)
+
+func (d Decoder) Render(out io.Writer) error {
+	return decoderTmpl.Execute(out, d)
+}
+
+func NewDecoder(spec *ast.TypeSpec) (*Decoder, error) {
+	st, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a struct", spec.Name.Name)
+	}
+
+	d := &Decoder{StructName: spec.Name.Name}
+	for _, f := range st.Fields.List {
+		fieldType := types.ExprString(f.Type)
+		jsonName := ""
+		if f.Tag != nil {
+			tag := reflect.StructTag(strings.Trim(f.Tag.Value, "`"))
+			jsonName = strings.Split(tag.Get("json"), ",")[0]
+		}
+		if jsonName == "-" {
+			continue
+		}
+
+		for _, name := range f.Names {
+			if !name.IsExported() {
+				continue
+			}
+			if !supportedTypes[fieldType] {
+				return nil, fmt.Errorf("%s.%s: unsupported type %s", d.StructName, name.Name, fieldType)
+			}
+
+			field := Field{Name: name.Name, JSONName: jsonName, Type: fieldType}
+			if field.JSONName == "" {
+				field.JSONName = name.Name
+			}
+			d.Fields = append(d.Fields, field)
+		}
+	}
+
+	return d, nil
+}
+
+func hasLabel(doc *ast.CommentGroup) bool {
+	if doc == nil {
+		return false
+	}
+	for _, comment := range doc.List {
+		if labelPattern.MatchString(comment.Text) {
+			return true
+		}
+	}
+	return false
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatal("usage: ./decoder_gen <source_file> <destination_file>")
+	}
+
+	fset := token.NewFileSet()
+	srcFilePath, dstFilePath := os.Args[1], os.Args[2]
+	in, err := parser.ParseFile(fset, srcFilePath, nil, parser.ParseComments)
+	if err != nil {
+		log.Fatalf("failed to parse file %s due %v", srcFilePath, err)
+	}
+
+	var decoders []*Decoder
+	for _, node := range in.Decls {
+		gd, ok := node.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if !hasLabel(gd.Doc) && !hasLabel(ts.Doc) {
+				log.Printf("skip type %s due it hasn't jsongen:decoder label", ts.Name.Name)
+				continue
+			}
+
+			decoder, err := NewDecoder(ts)
+			if err != nil {
+				log.Fatalf("failed to create decoder due %v", err)
+			}
+			decoders = append(decoders, decoder)
+		}
+	}
+
+	src := new(bytes.Buffer)
+	fmt.Fprintf(src, "// Code generated by decoder_gen from %s; DO NOT EDIT.\n\n", srcFilePath)
+	fmt.Fprintf(src, "package %s\n", in.Name.Name)
+	for _, decoder := range decoders {
+		if err := decoder.Render(src); err != nil {
+			log.Fatalf("failed to render decoder %s due %v", decoder.StructName, err)
+		}
+	}
+	writeSource(dstFilePath, src.Bytes())
+
+	lexer := new(bytes.Buffer)
+	fmt.Fprintf(lexer, "// Code generated by decoder_gen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(lexer, "package %s\n", in.Name.Name)
+	fmt.Fprintln(lexer, `
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+	"unsafe"
+)`)
+	fmt.Fprint(lexer, lexerTmpl)
+	writeSource(filepath.Join(filepath.Dir(dstFilePath), lexerFile), lexer.Bytes())
+}
+
+// lexerFile - файл с jsonLexer, одинаковый для всех декодеров пакета
+const lexerFile = "json_lexer.go"
+
+func writeSource(path string, src []byte) {
+	formatted, err := format.Source(src)
+	if err != nil {
+		log.Fatalf("failed to format generated code due %v", err)
+	}
+
+	if err := os.WriteFile(path, formatted, 0644); err != nil {
+		log.Fatalf("failed to write destination file %s due %v", path, err)
+	}
+}
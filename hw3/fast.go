@@ -1,63 +1,263 @@
-package main 
-
-import ( 
-	"bufio" 
-	"bytes" 
-	"encoding/json" 
-	"fmt" 
-	"io" 
-	"os" 
-	"strings" 
-) 
-
-type User struct { 
-	Name string `json:"name"` 
-	Email string `json:"email"` 
-	Browsers []string `json:"browsers"` 
-} 
-
-func FastSearch(out io.Writer) { 
-	file, err := os.Open(filePath) 
-	if err != nil { 
-		panic(err) 
-	} 
-	defer file.Close() 
-	
-	scanner := bufio.NewScanner(file) 
-	seenBrowsers := make(map[string]struct{}) 
-	var foundUsers bytes.Buffer 
-	userIndex := 0 
-	
-	for scanner.Scan() { 
-		line := scanner.Bytes() 
-		var user User 
-		if err := json.Unmarshal(line, &user); err != nil { 
-			panic(err) 
-		} 
-		
-		isAndroid := false 
-		isMSIE := false 
-		
-		for _, browser := range user.Browsers { 
-			if strings.Contains(browser, "Android") { 
-				isAndroid = true 
-				seenBrowsers[browser] = struct{}{} 
-			} 
-			
-			if strings.Contains(browser, "MSIE") { 
-				isMSIE = true 
-				seenBrowsers[browser] = struct{}{} 
-			} 
-		} 
-		
-		if isAndroid && isMSIE { 
-			email := strings.Replace(user.Email, "@", " [at] ", 1) 
-			fmt.Fprintf(&foundUsers, "[%d] %s <%s>\n", userIndex, user.Name, email) 
-		} 
-		
-		userIndex++ 
-	} 
-	
-	fmt.Fprintln(out, "found users:\n"+foundUsers.String()) 
-	fmt.Fprintln(out, "Total unique browsers", len(seenBrowsers)) 
-}
\ No newline at end of file
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+)
+
+// FastSearch - оптимизированный SlowSearch.
+// Вместо panic на битой строке возвращает *LineError
+func FastSearch(out io.Writer) error {
+	return QuerySearch(NewTextWriter(out), defaultQuery, ScanOptions{})
+}
+
+// QuerySearch - FastSearch с произвольным запросом вместо Android && MSIE
+// Файл читается так же, как в SearchFiles (см. scanFile): снапшот, mmap, Workers и gzip учитываются
+func QuerySearch(w ResultWriter, q *Query, opts ScanOptions) error {
+	res, _, err := scanFile(filePath, q, opts)
+	if err != nil {
+		return err
+	}
+	if err := opts.Errors.report(filePath, res.bad); err != nil {
+		return err
+	}
+	return writeAll(w, res.found, res.stats())
+}
+
+func scanPath(path string, q *Query, opts ScanOptions) (scanResult, error) {
+	if opts.Mmap {
+		res, _, err := scanMapped(path, q, opts)
+		return res, err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return scanResult{}, err
+	}
+	defer file.Close()
+
+	return scanUsers(file, q, opts)
+}
+
+// ScanOptions - настройки прохода по файлу пользователей
+type ScanOptions struct {
+	Errors ErrorPolicy
+	// Precision > 0 включает приблизительный подсчёт уникальных браузеров через HyperLogLog
+	// с 2^Precision регистрами: память не растёт с числом браузеров, в статистике появляется ошибка оценки
+	Precision uint8
+	// Fields - поля, которые попадут в вывод, пустая маска - поля по умолчанию (DefaultFields).
+	// Из JSON разбираются только они и поля, нужные запросу
+	Fields UserFields
+	// Mmap - читать файл через mmap, а не bufio.Scanner: меньше копирований и нет ограничения на длину строки.
+	// Только для файлов, которые не меняются во время чтения: если файл обрезать, пока он отображён,
+	// обращение к пропавшим страницам убивает процесс сигналом SIGBUS
+	Mmap bool
+	// Workers > 0 - несжатые файлы делятся на куски и читаются на Workers горутинах (см. ParallelSearch)
+	Workers int
+}
+
+// decodeFields - поля, которые нужно разобрать для запроса q
+func (opts ScanOptions) decodeFields(q *Query) UserFields {
+	if opts.Fields == 0 {
+		return q.Fields() | fieldsMask(nil)
+	}
+	return q.Fields() | opts.Fields
+}
+
+type scanResult struct {
+	found []FoundUser
+	seen  browserCounter
+	lines int
+	bad   []badLine
+}
+
+func (r scanResult) stats() SearchStats {
+	return SearchStats{
+		Lines:          r.lines,
+		Matched:        len(r.found),
+		UniqueBrowsers: r.seen.Count(),
+		StdError:       r.seen.StdError(),
+		Skipped:        len(r.bad),
+	}
+}
+
+// userScanner проверяет строки файла пользователей по одной, общий для чтения через bufio.Scanner и mmap.
+// Индексы найденных пользователей и номера плохих строк считаются от первой строки.
+// Плохие строки тоже учитываются в индексах, чтобы индексы совпадали с номерами строк файла
+type userScanner struct {
+	opts    ScanOptions
+	matcher *Matcher
+	fields  UserFields
+	res     scanResult
+	offset  int64
+	user    User
+	// borrow - строки пользователя ссылаются на строку файла (см. DecodeJSONFieldsBorrow),
+	// всё, что остаётся после строки, копируется: найденные пользователи и ключи seen
+	borrow bool
+	seen   browserCounter
+}
+
+func newUserScanner(q *Query, opts ScanOptions, borrow bool) (*userScanner, error) {
+	seen, err := newBrowserCounter(opts)
+	if err != nil {
+		return nil, err
+	}
+	s := &userScanner{opts: opts, matcher: q.NewMatcher(), fields: opts.decodeFields(q), res: scanResult{seen: seen}, borrow: borrow, seen: seen}
+	if exact, ok := seen.(exactBrowsers); ok && borrow {
+		s.seen = ownedBrowsers{exact}
+	}
+	return s, nil
+}
+
+// line обрабатывает очередную строку, size - сколько байт она заняла в файле вместе с концом строки.
+// Без borrow строка нужна только на время вызова,
+// с borrow - пока живы найденные в ней значения до копирования, то есть до конца прохода
+func (s *userScanner) line(line []byte, size int) error {
+	res := &s.res
+	var err error
+	if s.borrow {
+		err = s.user.DecodeJSONFieldsBorrow(line, s.fields)
+	} else {
+		err = s.user.DecodeJSONFields(line, s.fields)
+	}
+
+	if err != nil {
+		bad, err := s.opts.Errors.lineError(line, res.lines+1, s.offset, err)
+		if err != nil {
+			return err
+		}
+		res.bad = append(res.bad, bad)
+	} else if s.matcher.Match(&s.user, s.seen) {
+		found := newFoundUser(res.lines, &s.user, s.matcher)
+		if s.borrow {
+			found = found.own()
+		}
+		res.found = append(res.found, found)
+	}
+
+	s.offset += int64(size)
+	res.lines++
+	return nil
+}
+
+// lineScanner - bufio.Scanner по строкам, который помнит размер последней строки в потоке.
+// Bytes() отдаёт строку без \r\n, поэтому смещения по len(Bytes()) разъезжаются на файлах с CRLF
+type lineScanner struct {
+	*bufio.Scanner
+	size int
+}
+
+func newLineScanner(r io.Reader) *lineScanner {
+	s := &lineScanner{Scanner: bufio.NewScanner(r)}
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			s.size = advance
+		}
+		return advance, token, err
+	})
+	return s
+}
+
+func scanUsers(r io.Reader, q *Query, opts ScanOptions) (scanResult, error) {
+	s, err := newUserScanner(q, opts, false)
+	if err != nil {
+		return scanResult{}, err
+	}
+
+	scanner := newLineScanner(r)
+	for scanner.Scan() {
+		if err := s.line(scanner.Bytes(), scanner.size); err != nil {
+			return s.res, err
+		}
+	}
+	return s.res, scanner.Err()
+}
+
+// scanMapped - scanUsers по файлу, отображённому в память: строки - срезы отображения без копирования
+// и без ограничения длины, которое есть у bufio.Scanner (64KB). Концы строк как у bufio.ScanLines.
+// Строки пользователей тоже не копируются, копии делаются только для найденных пользователей и новых браузеров.
+// Сжатый gzip файл читается потоком, как обычно
+func scanMapped(path string, q *Query, opts ScanOptions) (scanResult, Progress, error) {
+	data, unmap, err := mapFile(path)
+	if err != nil {
+		return scanResult{}, Progress{}, err
+	}
+	defer unmap()
+
+	progress := Progress{Path: path, Bytes: int64(len(data)), Gzip: bytes.HasPrefix(data, gzipMagic)}
+	if progress.Gzip {
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return scanResult{}, progress, err
+		}
+		res, err := scanUsers(gz, q, opts)
+		progress.Lines = res.lines
+		return res, progress, err
+	}
+
+	s, err := newUserScanner(q, opts, true)
+	if err != nil {
+		return scanResult{}, progress, err
+	}
+	for len(data) > 0 {
+		line, size := data, len(data)
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			line, size = data[:i], i+1
+		}
+		data = data[size:]
+		if err := s.line(dropCR(line), size); err != nil {
+			return s.res, progress, err
+		}
+	}
+	progress.Lines = s.res.lines
+	return s.res, progress, nil
+}
+
+func dropCR(line []byte) []byte {
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		return line[:len(line)-1]
+	}
+	return line
+}
+
+func newFoundUser(index int, u *User, m *Matcher) FoundUser {
+	return FoundUser{
+		Index:    index,
+		Name:     u.Name,
+		Email:    u.Email,
+		Country:  u.Country,
+		Company:  u.Company,
+		Job:      u.Job,
+		Phone:    u.Phone,
+		Browsers: append([]string(nil), m.MatchedBrowsers()...),
+	}
+}
+
+// own копирует строки, чтобы пользователь не ссылался на отображённый файл после munmap
+func (u FoundUser) own() FoundUser {
+	u.Name = cloneString(u.Name)
+	u.Email = cloneString(u.Email)
+	u.Country = cloneString(u.Country)
+	u.Company = cloneString(u.Company)
+	u.Job = cloneString(u.Job)
+	u.Phone = cloneString(u.Phone)
+	for i, browser := range u.Browsers {
+		u.Browsers[i] = cloneString(browser)
+	}
+	return u
+}
+
+func cloneString(s string) string {
+	if s == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.Grow(len(s))
+	b.WriteString(s)
+	return b.String()
+}
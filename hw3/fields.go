@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultFields - поля вывода по умолчанию, как в исходном FastSearch
+var DefaultFields = []UserFields{UserFieldName, UserFieldEmail, UserFieldBrowsers}
+
+// ParseFields разбирает список полей через запятую, например "name,phone", порядок сохраняется
+func ParseFields(list string) ([]UserFields, error) {
+	var fields []UserFields
+	for _, name := range strings.Split(list, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		f, ok := UserFieldsByName[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown field %s, expected one of %s", name, strings.Join(fieldNames(UserAllFields), ", "))
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// fieldsMask объединяет поля в маску, пустой список - поля по умолчанию
+func fieldsMask(fields []UserFields) UserFields {
+	if len(fields) == 0 {
+		fields = DefaultFields
+	}
+	var mask UserFields
+	for _, f := range fields {
+		mask |= f
+	}
+	return mask
+}
+
+// fieldNames - имена полей маски в порядке объявления в User
+func fieldNames(mask UserFields) []string {
+	var names []string
+	for f := UserFields(1); f <= mask; f <<= 1 {
+		if mask&f != 0 {
+			names = append(names, fieldName(f))
+		}
+	}
+	return names
+}
+
+func fieldName(f UserFields) string {
+	for name, field := range UserFieldsByName {
+		if field == f {
+			return name
+		}
+	}
+	return ""
+}
+
+// fieldValue - значение одного поля найденного пользователя для текстовых форматов
+func (u FoundUser) fieldValue(f UserFields) string {
+	switch f {
+	case UserFieldName:
+		return u.Name
+	case UserFieldEmail:
+		return u.Email
+	case UserFieldCountry:
+		return u.Country
+	case UserFieldCompany:
+		return u.Company
+	case UserFieldJob:
+		return u.Job
+	case UserFieldPhone:
+		return u.Phone
+	case UserFieldBrowsers:
+		return strings.Join(u.Browsers, "|")
+	default:
+		return ""
+	}
+}
+
+// project оставляет только поля из mask, Index остаётся всегда
+func (u FoundUser) project(mask UserFields) FoundUser {
+	if mask&UserFieldName == 0 {
+		u.Name = ""
+	}
+	if mask&UserFieldEmail == 0 {
+		u.Email = ""
+	}
+	if mask&UserFieldCountry == 0 {
+		u.Country = ""
+	}
+	if mask&UserFieldCompany == 0 {
+		u.Company = ""
+	}
+	if mask&UserFieldJob == 0 {
+		u.Job = ""
+	}
+	if mask&UserFieldPhone == 0 {
+		u.Phone = ""
+	}
+	if mask&UserFieldBrowsers == 0 {
+		u.Browsers = nil
+	}
+	return u
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const fieldsInput = `{"browsers":["Mozilla/4.0 (compatible; MSIE 7.0)"],"company":"Flashpoint","country":"Chile","email":"a@b.c","job":"Analyst","name":"Sharon Crawford","phone":"176-88-49"}
+{"browsers":["Mozilla/4.0 (compatible; MSIE 8.0)"],"company":"Flashpoint","country":"Kenya","email":"x@y.z","job":"Manager","name":"John Doe","phone":"120-11-22"}
+{"browsers":["Opera/9.80"],"company":"Flashpoint","country":"Chile","email":"q@w.e","job":"Analyst","name":"Jane Roe","phone":"555-00-00"}`
+
+func TestParseFields(t *testing.T) {
+	fields, err := ParseFields(" Name, phone ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fields, []UserFields{UserFieldName, UserFieldPhone}) {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if _, err := ParseFields("name,salary"); err == nil {
+		t.Error("expected error for unknown field")
+	}
+	if got := strings.Join(fieldNames(UserAllFields), ","); got != "name,email,country,company,job,phone,browsers" {
+		t.Errorf("unexpected field names %s", got)
+	}
+}
+
+func TestUserDecodeJSONFields(t *testing.T) {
+	line := []byte(strings.Split(fieldsInput, "\n")[0])
+	user := User{Email: "stale", Browsers: []string{"stale"}}
+	if err := user.DecodeJSONFields(line, UserFieldName|UserFieldPhone); err != nil {
+		t.Fatal(err)
+	}
+	expected := User{Name: "Sharon Crawford", Phone: "176-88-49", Browsers: []string{}}
+	if !reflect.DeepEqual(user, expected) {
+		t.Errorf("decoded %+v, expected %+v", user, expected)
+	}
+}
+
+func TestQueryFields(t *testing.T) {
+	q := MustCompileQuery(`browser~"MSIE" AND company="Flashpoint" AND country="Chile"`)
+	if want := UserFieldBrowsers | UserFieldCompany | UserFieldCountry; q.Fields() != want {
+		t.Errorf("query fields %b, want %b", q.Fields(), want)
+	}
+	if q := MustCompileQuery(`job~"Analyst" OR phone="1"`); q.Fields() != UserFieldJob|UserFieldPhone {
+		t.Errorf("unexpected query fields %b", q.Fields())
+	}
+}
+
+func searchFields(t *testing.T, format, expr string, fields []UserFields, redaction RedactionPolicy) string {
+	out := new(bytes.Buffer)
+	w, err := NewResultWriter(format, out, ResultOptions{Fields: fields, Redaction: redaction})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := ScanOptions{Fields: fieldsMask(fields)}
+	if err := SearchReader(w, strings.NewReader(fieldsInput), MustCompileQuery(expr), opts); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestSearchFields(t *testing.T) {
+	expr := `browser~"MSIE" AND company="Flashpoint" AND country="Chile"`
+	fields := []UserFields{UserFieldName, UserFieldPhone}
+
+	text := searchFields(t, FormatText, expr, fields, RedactionPolicy{})
+	if expected := "found users:\n[0] Sharon Crawford | 176-88-49\n\nTotal unique browsers 2\n"; text != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", text, expected)
+	}
+
+	csv := searchFields(t, FormatCSV, `job="Analyst"`, []UserFields{UserFieldPhone, UserFieldCountry}, RedactionPolicy{Phone: RedactMask})
+	if !strings.HasPrefix(csv, "index,phone,country\n0,***-**-49,Chile\n2,***-**-00,Chile\n") {
+		t.Errorf("unexpected csv:\n%s", csv)
+	}
+
+	json := searchFields(t, FormatJSON, expr, fields, RedactionPolicy{})
+	if !strings.Contains(json, `{"index":0,"name":"Sharon Crawford","phone":"176-88-49"}`) {
+		t.Errorf("unexpected json:\n%s", json)
+	}
+}
+
+func TestSnapshotFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := os.WriteFile(path, []byte(fieldsInput), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildSnapshot(path, SnapshotPath(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	snap := openSnapshot(path)
+	if snap == nil {
+		t.Fatal("fresh snapshot is not used")
+	}
+	res, err := snap.scan(MustCompileQuery(`company="Flashpoint" AND job="Manager"`), ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.found) != 1 || res.found[0].Phone != "120-11-22" || res.found[0].Country != "Kenya" {
+		t.Errorf("unexpected result %+v", res.found)
+	}
+}
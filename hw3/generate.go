@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+)
+
+// GenerateOptions - параметры синтетического users.txt.
+// AndroidShare и MSIEShare - доли строк браузеров с Android и MSIE, остальное - прочие браузеры.
+// По умолчанию доли как в data/users.txt: 13% и 7%, в среднем 4 браузера на пользователя
+type GenerateOptions struct {
+	Lines        int
+	Seed         int64
+	AndroidShare float64
+	MSIEShare    float64
+	// BrowsersPerUser - максимум браузеров у пользователя, реальное число от 1 до него
+	BrowsersPerUser int
+}
+
+var DefaultGenerateOptions = GenerateOptions{
+	Lines:           1000,
+	Seed:            1,
+	AndroidShare:    0.13,
+	MSIEShare:       0.07,
+	BrowsersPerUser: 7,
+}
+
+// generatedUser - запись users.txt, поля в том же порядке, что и в исходном файле
+type generatedUser struct {
+	Browsers []string `json:"browsers"`
+	Company  string   `json:"company"`
+	Country  string   `json:"country"`
+	Email    string   `json:"email"`
+	Job      string   `json:"job"`
+	Name     string   `json:"name"`
+	Phone    string   `json:"phone"`
+}
+
+var (
+	genFirstNames = []string{"Sharon", "Susan", "Jonathan", "Gregory", "Kathy", "Ruth", "Jeremy", "Diana", "Walter", "Emily",
+		"Paul", "Joan", "Carlos", "Anne", "Roger", "Martha", "Louis", "Judy", "Harold", "Irene"}
+	genLastNames = []string{"Crawford", "Ellis", "Morris", "Long", "King", "Ramirez", "Hughes", "Fisher", "Porter", "Reyes",
+		"Wagner", "Gordon", "Dunn", "Mills", "Bishop", "Lane", "Simpson", "Burke", "Tucker", "Hart"}
+	genCompanies = []string{"Flashpoint", "Jatri", "Muxo", "Topiczoom", "Voonix", "Bluezoom", "Zoombox", "Leexo", "Thoughtsphere",
+		"Brightbean", "Dynabox", "Skajo", "Meeveo", "Yodoo", "Quimba", "Tagfeed", "Realcube", "Jabbertype"}
+	genCountries = []string{"Dominican Republic", "Kenya", "Ecuador", "Thailand", "Uruguay", "Germany", "Equatorial Guinea",
+		"Turkmenistan", "Bahamas", "Vietnam", "Russia", "Brazil", "Canada", "India", "Norway", "Peru", "Japan", "Mali"}
+	genJobs = []string{"Programmer Analyst #{N}", "Web Developer #{N}", "Internal Auditor", "Office Assistant #{N}",
+		"Automation Specialist #{N}", "Cost Accountant", "Electrical Engineer", "Research Assistant #{N}",
+		"Senior Quality Engineer", "Social Worker", "Environmental Specialist", "Staff Scientist", "Operator",
+		"Developer #{N}", "Biostatistician #{N}"}
+	genTLDs  = []string{"com", "net", "org", "edu", "gov", "info", "name", "biz", "mil"}
+	genLorem = []string{"eum", "rerum", "explicabo", "accusamus", "et", "magnam", "sed", "reiciendis", "qui", "est",
+		"ratione", "maxime", "adipisci", "sunt", "hic", "iusto", "dolor", "amet"}
+
+	genDevices = []string{"GT-I9000", "Nexus One", "HTC Desire", "T-Mobile_G2_Touch", "SAMSUNG-SGH-I897", "LG-P500", "MB525", "Xperia X10"}
+	genLocales = []string{"en-us", "en-gb", "de-de", "ru-ru", "fr-fr", "es-es"}
+)
+
+// генераторы строк браузеров. Сами по себе они дают всё новые версии, поэтому браузеры берутся
+// из пулов, заполненных ими один раз (см. agentPool)
+var (
+	genAndroidAgents = []func(r *rand.Rand) string{
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Mozilla/5.0 (Linux; U; Android %d.%d; %s; %s Build/%s) AppleWebKit/533.1 (KHTML, like Gecko) Version/4.0 Mobile Safari/533.1",
+				1+r.Intn(4), r.Intn(5), pick(r, genLocales), pick(r, genDevices), buildID(r))
+		},
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Mozilla/5.0 (Android; Linux armv7l; rv:%d.0.%d) Gecko/20100101 Firefox/%d.0.%d Fennec/%d.0.%d",
+				5+r.Intn(20), r.Intn(3), 5+r.Intn(20), r.Intn(3), 5+r.Intn(20), r.Intn(3))
+		},
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Mozilla/5.0 (Linux; Android %d.%d.%d; %s) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.%d.%d Mobile Safari/537.36",
+				4+r.Intn(4), r.Intn(4), r.Intn(3), pick(r, genDevices), 30+r.Intn(30), 1000+r.Intn(2000), r.Intn(200))
+		},
+	}
+	genMSIEAgents = []func(r *rand.Rand) string{
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Mozilla/4.0 (compatible; MSIE %d.0; Windows NT %d.%d; Trident/%d.0)",
+				5+r.Intn(6), 5+r.Intn(2), r.Intn(3), 4+r.Intn(3))
+		},
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Mozilla/5.0 (compatible; MSIE %d.0; Windows NT 6.%d; WOW64; Trident/%d.0; .NET CLR %d.0.%d)",
+				8+r.Intn(3), r.Intn(3), 4+r.Intn(3), 2+r.Intn(2), 50000+r.Intn(10000))
+		},
+	}
+	genOtherAgents = []func(r *rand.Rand) string{
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/%d.0.%d.%d Safari/537.36",
+				10+r.Intn(50), 500+r.Intn(2500), r.Intn(200))
+		},
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Mozilla/5.0 (Windows NT %d.%d; WOW64; rv:%d.0) Gecko/20100101 Firefox/%d.0",
+				6+r.Intn(5), r.Intn(4), 3+r.Intn(50), 3+r.Intn(50))
+		},
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Mozilla/5.0 (iPad; CPU OS %d_%d like Mac OS X) AppleWebKit/601.1 (KHTML, like Gecko) Version/%d.0 Mobile/14A%d Safari/601.1",
+				4+r.Intn(8), r.Intn(4), 4+r.Intn(8), 1000+r.Intn(9000))
+		},
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; rv:%d.0) like Gecko", 9+r.Intn(3))
+		},
+		func(r *rand.Rand) string {
+			return fmt.Sprintf("Opera/9.%d (Windows NT %d.%d; U; %s) Presto/2.%d.%d Version/%d.%d",
+				r.Intn(100), 5+r.Intn(2), r.Intn(2), pick(r, genLocales), r.Intn(12), 100+r.Intn(300), 10+r.Intn(3), r.Intn(100))
+		},
+	}
+)
+
+// Размеры пулов браузеров: в data/users.txt 114 уникальных браузеров Android и MSIE на 1000 строк.
+// Пулы не растут с файлом, иначе SlowSearch, который ищет браузер в списке уже виденных перебором,
+// на миллионах строк работает квадратичное время
+const (
+	genAndroidPool = 75
+	genMSIEPool    = 40
+	genOtherPool   = 200
+)
+
+var (
+	genAndroidBrowsers = agentPool(genAndroidAgents, genAndroidPool)
+	genMSIEBrowsers    = agentPool(genMSIEAgents, genMSIEPool)
+	genOtherBrowsers   = agentPool(genOtherAgents, genOtherPool)
+)
+
+// agentPool заполняет пул из n разных строк браузеров. Пул не зависит от GenerateOptions.Seed,
+// seed влияет только на выбор браузеров из пула
+func agentPool(gens []func(r *rand.Rand) string, n int) []string {
+	r := rand.New(rand.NewSource(int64(n)))
+	seen := make(map[string]bool, n)
+	pool := make([]string, 0, n)
+	for len(pool) < n {
+		agent := gens[r.Intn(len(gens))](r)
+		if !seen[agent] {
+			seen[agent] = true
+			pool = append(pool, agent)
+		}
+	}
+	return pool
+}
+
+func pick(r *rand.Rand, list []string) string {
+	return list[r.Intn(len(list))]
+}
+
+func buildID(r *rand.Rand) string {
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	return fmt.Sprintf("%c%c%c%d", letters[r.Intn(26)], letters[r.Intn(26)], letters[r.Intn(26)], 10+r.Intn(90))
+}
+
+func (o GenerateOptions) validate() error {
+	switch {
+	case o.Lines < 0:
+		return fmt.Errorf("negative number of lines %d", o.Lines)
+	case o.AndroidShare < 0 || o.MSIEShare < 0 || o.AndroidShare+o.MSIEShare > 1:
+		return fmt.Errorf("bad browser mix: android %v, msie %v", o.AndroidShare, o.MSIEShare)
+	case o.BrowsersPerUser < 1:
+		return fmt.Errorf("browsers per user must be positive, got %d", o.BrowsersPerUser)
+	}
+	return nil
+}
+
+func (o GenerateOptions) browser(r *rand.Rand) string {
+	switch x := r.Float64(); {
+	case x < o.AndroidShare:
+		return pick(r, genAndroidBrowsers)
+	case x < o.AndroidShare+o.MSIEShare:
+		return pick(r, genMSIEBrowsers)
+	}
+	return pick(r, genOtherBrowsers)
+}
+
+func (o GenerateOptions) user(r *rand.Rand) generatedUser {
+	first, last, company := pick(r, genFirstNames), pick(r, genLastNames), pick(r, genCompanies)
+
+	var login string
+	if r.Intn(2) == 0 {
+		login = string(rune('a'+r.Intn(26))) + last
+	} else {
+		words := make([]string, 1+r.Intn(3))
+		for i := range words {
+			words[i] = pick(r, genLorem)
+		}
+		login = strings.Join(words, "_")
+	}
+
+	u := generatedUser{
+		Browsers: make([]string, 1+r.Intn(o.BrowsersPerUser)),
+		Company:  company,
+		Country:  pick(r, genCountries),
+		Email:    login + "@" + company + "." + pick(r, genTLDs),
+		Job:      pick(r, genJobs),
+		Name:     first + " " + last,
+		Phone:    fmt.Sprintf("%03d-%02d-%02d", r.Intn(1000), r.Intn(100), r.Intn(100)),
+	}
+	for i := range u.Browsers {
+		u.Browsers[i] = o.browser(r)
+	}
+	return u
+}
+
+// GenerateUsers пишет opts.Lines синтетических пользователей в формате data/users.txt.
+// Результат зависит только от opts. Как и в исходном файле, после последней строки нет '\n' -
+// SlowSearch считает пустую строку ошибкой
+func GenerateUsers(out io.Writer, opts GenerateOptions) error {
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	r := rand.New(rand.NewSource(opts.Seed))
+	w := bufio.NewWriter(out)
+
+	for i := 0; i < opts.Lines; i++ {
+		if i > 0 {
+			w.WriteByte('\n')
+		}
+
+		data, err := json.Marshal(opts.user(r))
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+	}
+
+	return w.Flush()
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// go test -bench Scale -benchmem -timeout 0 -bench-sizes 10000,1000000,10000000
+var (
+	benchSizes = flag.String("bench-sizes", "10000", "comma-separated line counts for BenchmarkScale")
+	benchDir   = flag.String("bench-dir", os.TempDir(), "where BenchmarkScale keeps generated files between runs")
+	// SlowSearch держит в памяти весь файл и всех пользователей и собирает вывод конкатенацией строк,
+	// поэтому на 1M строк работает минуты, а на 10M - часы и требует десятки гигабайт памяти
+	benchSlowMax = flag.Int("bench-slow-max", 1000000, "largest file in lines to run SlowSearch on in BenchmarkScale")
+)
+
+// withUsersFile подменяет filePath на время f
+func withUsersFile(path string, f func()) {
+	saved := filePath
+	filePath = path
+	defer func() { filePath = saved }()
+	f()
+}
+
+func TestGenerateUsers(t *testing.T) {
+	opts := DefaultGenerateOptions
+	opts.Lines = 2000
+
+	first, second := new(bytes.Buffer), new(bytes.Buffer)
+	if err := GenerateUsers(first, opts); err != nil {
+		t.Fatal(err)
+	}
+	GenerateUsers(second, opts)
+	if !bytes.Equal(first.Bytes(), second.Bytes()) {
+		t.Error("same seed should give the same file")
+	}
+
+	lines := strings.Split(first.String(), "\n")
+	if len(lines) != opts.Lines {
+		t.Fatalf("expected %d lines, got %d", opts.Lines, len(lines))
+	}
+
+	var user User
+	browsers, android := 0, 0
+	for i, line := range lines {
+		if err := user.DecodeJSON([]byte(line)); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if user.Name == "" || !strings.Contains(user.Email, "@") || len(user.Browsers) == 0 {
+			t.Fatalf("line %d: incomplete user %+v", i+1, user)
+		}
+		for _, b := range user.Browsers {
+			browsers++
+			if strings.Contains(b, "Android") {
+				android++
+			}
+		}
+	}
+	if share := float64(android) / float64(browsers); share < 0.1 || share > 0.16 {
+		t.Errorf("android share %.3f is far from %.2f", share, opts.AndroidShare)
+	}
+
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := os.WriteFile(path, first.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	slowOut, fastOut := new(bytes.Buffer), new(bytes.Buffer)
+	withUsersFile(path, func() {
+		if err := SlowSearch(slowOut); err != nil {
+			t.Fatal(err)
+		}
+		if err := FastSearch(fastOut); err != nil {
+			t.Fatal(err)
+		}
+		if slowOut.String() != fastOut.String() {
+			t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", fastOut, slowOut)
+		}
+	})
+
+	refOut := new(bytes.Buffer)
+	if err := referenceSearch(refOut, path); err != nil {
+		t.Fatal(err)
+	}
+	if refOut.String() != slowOut.String() {
+		t.Errorf("reference results not match\nGot:\n%v\nExpected:\n%v", refOut, slowOut)
+	}
+
+	// браузеры берутся из пулов, поэтому их число не растёт с размером файла
+	if !strings.HasSuffix(slowOut.String(), fmt.Sprintf("Total unique browsers %d\n", genAndroidPool+genMSIEPool)) {
+		t.Errorf("expected %d unique browsers, got %s", genAndroidPool+genMSIEPool, slowOut.String()[strings.LastIndex(slowOut.String(), "Total"):])
+	}
+
+	if err := GenerateUsers(ioutil.Discard, GenerateOptions{Lines: 1, AndroidShare: 0.8, MSIEShare: 0.5, BrowsersPerUser: 1}); err == nil {
+		t.Error("expected error for browser shares above 1")
+	}
+}
+
+// scaleFileVersion меняется вместе с генератором, чтобы не брать файлы, оставшиеся от прошлых версий
+const scaleFileVersion = 2
+
+// scaleFile возвращает путь к сгенерированному файлу на n строк, создавая его при первом запуске
+func scaleFile(b *testing.B, n int) string {
+	opts := DefaultGenerateOptions
+	opts.Lines = n
+	path := filepath.Join(*benchDir, fmt.Sprintf("hw3-users-%d-seed%d-v%d.txt", n, opts.Seed, scaleFileVersion))
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+
+	file, err := os.Create(path + ".tmp")
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := GenerateUsers(file, opts); err != nil {
+		b.Fatal(err)
+	}
+	if err := file.Close(); err != nil {
+		b.Fatal(err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		b.Fatal(err)
+	}
+	return path
+}
+
+func BenchmarkScale(b *testing.B) {
+	for _, field := range strings.Split(*benchSizes, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			b.Fatalf("bad -bench-sizes: %v", err)
+		}
+
+		path := scaleFile(b, n)
+		withUsersFile(path, func() {
+			// вывод пишется в буферы прямо в замерах, чтобы не запускать SlowSearch лишний раз
+			slowOut, fastOut := new(bytes.Buffer), new(bytes.Buffer)
+			if n <= *benchSlowMax {
+				b.Run(fmt.Sprintf("Slow/%d", n), func(b *testing.B) {
+					for i := 0; i < b.N; i++ {
+						slowOut.Reset()
+						SlowSearch(slowOut)
+					}
+				})
+			} else {
+				// вместо SlowSearch - его потоковый аналог, который укладывается в память
+				if err := referenceSearch(slowOut, path); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.Run(fmt.Sprintf("Fast/%d", n), func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					fastOut.Reset()
+					FastSearch(fastOut)
+				}
+			})
+
+			if !bytes.Equal(slowOut.Bytes(), fastOut.Bytes()) {
+				b.Fatalf("%d lines: SlowSearch and FastSearch results not match", n)
+			}
+		})
+	}
+}
+
+// referenceSearch - SlowSearch без квадратичных мест: файл читается построчно, виденные браузеры
+// хранятся в map, вывод собирается в буфер. Разбор тот же - encoding/json в map и поиск подстрок
+func referenceSearch(out io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	seen := map[string]bool{}
+	found := new(bytes.Buffer)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+
+	for i := 0; scanner.Scan(); i++ {
+		user := make(map[string]interface{})
+		if err := json.Unmarshal(scanner.Bytes(), &user); err != nil {
+			return &LineError{Source: path, Line: i + 1, Err: err}
+		}
+		browsers, ok := user["browsers"].([]interface{})
+		if !ok {
+			continue
+		}
+
+		isAndroid, isMSIE := false, false
+		for _, raw := range browsers {
+			browser, ok := raw.(string)
+			if !ok {
+				continue
+			}
+			android, msie := strings.Contains(browser, "Android"), strings.Contains(browser, "MSIE")
+			isAndroid, isMSIE = isAndroid || android, isMSIE || msie
+			if android || msie {
+				seen[browser] = true
+			}
+		}
+		if isAndroid && isMSIE {
+			email := strings.ReplaceAll(user["email"].(string), "@", " [at] ")
+			fmt.Fprintf(found, "[%d] %s <%s>\n", i, user["name"], email)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(out, "found users:\n"+found.String())
+	fmt.Fprintln(out, "Total unique browsers", len(seen))
+	return nil
+}
@@ -0,0 +1,716 @@
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// Агрегации группировки: число пользователей в группе считается всегда, остальные задаются списком
+const (
+	AggDistinct = "distinct" // distinct(field) - число разных значений поля в группе
+	AggTop      = "top"      // top(field,k) - k самых частых значений поля в группе
+)
+
+// DefaultGroupMemory - сколько памяти группировка держит под состояние групп, прежде чем сбросить его на диск
+const DefaultGroupMemory = 64 << 20
+
+// Aggregation - агрегация по полю: поля пользователя, browser, family (семейство браузера) или os
+type Aggregation struct {
+	Kind  string
+	Field string
+	K     int
+}
+
+func (a Aggregation) String() string {
+	if a.Kind == AggTop {
+		return fmt.Sprintf("%s(%s,%d)", a.Kind, a.Field, a.K)
+	}
+	return fmt.Sprintf("%s(%s)", a.Kind, a.Field)
+}
+
+// ParseAggregations разбирает список вида "distinct(browser),top(family,3)". count допускается и ничего не добавляет
+func ParseAggregations(list string) ([]Aggregation, error) {
+	var aggs []Aggregation
+	for _, spec := range splitTopLevel(list) {
+		spec = strings.TrimSpace(spec)
+		if spec == "" || spec == "count" {
+			continue
+		}
+
+		open := strings.IndexByte(spec, '(')
+		if open < 0 || !strings.HasSuffix(spec, ")") {
+			return nil, fmt.Errorf("group: bad aggregation %s, expected count, distinct(field) or top(field,k)", spec)
+		}
+		agg := Aggregation{Kind: spec[:open]}
+		args := strings.Split(spec[open+1:len(spec)-1], ",")
+		agg.Field = strings.TrimSpace(args[0])
+
+		switch {
+		case agg.Kind == AggDistinct && len(args) == 1:
+		case agg.Kind == AggTop && len(args) == 2:
+			k, err := strconv.Atoi(strings.TrimSpace(args[1]))
+			if err != nil || k <= 0 {
+				return nil, fmt.Errorf("group: bad k in %s", spec)
+			}
+			agg.K = k
+		default:
+			return nil, fmt.Errorf("group: bad aggregation %s, expected count, distinct(field) or top(field,k)", spec)
+		}
+		if _, ok := groupFields[agg.Field]; !ok {
+			return nil, fmt.Errorf("group: unknown field %s in %s", agg.Field, spec)
+		}
+		aggs = append(aggs, agg)
+	}
+	return aggs, nil
+}
+
+// splitTopLevel делит по запятым вне скобок
+func splitTopLevel(s string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// groupField достаёт значения поля пользователя: у строковых полей одно значение,
+// у browser, family и os - по одному на браузер
+type groupField struct {
+	fields UserFields
+	values func(g *grouper, u *User, dst []string) []string
+}
+
+var groupFields = map[string]groupField{
+	"browser": {UserFieldBrowsers, func(g *grouper, u *User, dst []string) []string {
+		return append(dst, u.Browsers...)
+	}},
+	"family": {UserFieldBrowsers, func(g *grouper, u *User, dst []string) []string {
+		for _, browser := range u.Browsers {
+			dst = append(dst, g.userAgent(browser).Family)
+		}
+		return dst
+	}},
+	"os": {UserFieldBrowsers, func(g *grouper, u *User, dst []string) []string {
+		for _, browser := range u.Browsers {
+			dst = append(dst, g.userAgent(browser).OS)
+		}
+		return dst
+	}},
+}
+
+func init() {
+	for name, get := range queryFields {
+		get := get
+		groupFields[name] = groupField{UserFieldsByName[name], func(g *grouper, u *User, dst []string) []string {
+			return append(dst, get(u))
+		}}
+	}
+}
+
+// GroupOptions - настройки группировки
+type GroupOptions struct {
+	// By - поля группировки, по нескольким полям группа - сочетание значений.
+	// Пользователь с несколькими браузерами попадает во все группы своих семейств, но считается в каждой один раз
+	By   []string
+	Aggs []Aggregation
+	// Query - фильтр, применяется до группировки, nil - все пользователи
+	Query *Query
+	// Limit > 0 оставляет только Limit самых больших групп
+	Limit int
+	// MaxMemory - примерный предел памяти под группы в байтах, 0 - DefaultGroupMemory.
+	// При превышении группы сбрасываются на диск в TempDir отсортированными и в конце сливаются
+	MaxMemory int64
+	TempDir   string
+	Errors    ErrorPolicy
+	// Redaction - скрытие персональных данных, как в выводе поиска. Применяется к выводу:
+	// к значениям email, name и phone в ключах групп и в top, сами группы считаются по исходным значениям
+	Redaction RedactionPolicy
+}
+
+// GroupResult - группы, отсортированные по убыванию числа пользователей
+type GroupResult struct {
+	By   []string   `json:"by"`
+	Aggs []string   `json:"aggregations,omitempty"`
+	Rows []GroupRow `json:"rows"`
+	// Users - сколько пользователей прошло фильтр, Lines - строк в файле
+	Users   int `json:"users"`
+	Lines   int `json:"lines"`
+	Skipped int `json:"skipped,omitempty"`
+	// Spills - сколько раз состояние сбрасывалось на диск
+	Spills int `json:"spills,omitempty"`
+}
+
+type GroupRow struct {
+	Keys   []string     `json:"keys"`
+	Users  int          `json:"users"`
+	Values []GroupValue `json:"values,omitempty"`
+}
+
+// GroupValue - значение агрегации: Distinct для distinct, Top для top
+type GroupValue struct {
+	Distinct int        `json:"distinct,omitempty"`
+	Top      []TopValue `json:"top,omitempty"`
+}
+
+type TopValue struct {
+	Value string `json:"value"`
+	Users int    `json:"users"`
+}
+
+// groupState - частичное состояние группы. Для distinct и top хранятся все значения с числом пользователей,
+// поэтому состояния из разных сбросов на диск можно складывать
+type groupState struct {
+	users  int
+	values []map[string]int
+}
+
+func (st *groupState) merge(other *groupState) {
+	st.users += other.users
+	for i, counts := range other.values {
+		for v, n := range counts {
+			st.values[i][v] += n
+		}
+	}
+}
+
+// Примерная цена элементов состояния в памяти сверх длины строк: заголовки строк, ячейки map
+const (
+	groupOverhead = 128
+	valueOverhead = 48
+)
+
+// maxParsedAgents - предел кеша разобранных браузеров, чтобы он тоже не рос без ограничений
+const maxParsedAgents = 1 << 14
+
+type grouper struct {
+	opts   GroupOptions
+	redact *redactor
+	by     []groupField
+	aggs   []groupField
+	groups map[string]*groupState
+	mem    int64
+	runs   []string
+	parsed map[string]UserAgent
+
+	keyVals [][]string
+	aggVals []string
+	keys    []string
+}
+
+// GroupFile - GroupUsers по файлу path, битые строки в ошибках и карантине указываются с именем файла
+func GroupFile(path string, opts GroupOptions) (*GroupResult, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	res, err := groupUsers(file, path, opts)
+	return res, withSource(err, path)
+}
+
+// GroupUsers читает пользователей из r (в том числе gzip) и считает агрегации по группам
+func GroupUsers(r io.Reader, opts GroupOptions) (*GroupResult, error) {
+	res, err := groupUsers(r, readerSource, opts)
+	return res, withSource(err, readerSource)
+}
+
+func groupUsers(r io.Reader, source string, opts GroupOptions) (*GroupResult, error) {
+	if len(opts.By) == 0 {
+		return nil, fmt.Errorf("group: no fields to group by")
+	}
+	if opts.MaxMemory <= 0 {
+		opts.MaxMemory = DefaultGroupMemory
+	}
+
+	redact, err := newRedactor(opts.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	g := &grouper{opts: opts, redact: redact, groups: make(map[string]*groupState), parsed: make(map[string]UserAgent)}
+	res := &GroupResult{By: opts.By}
+	var fields UserFields
+	if opts.Query != nil {
+		fields = opts.Query.Fields()
+	}
+	for _, name := range opts.By {
+		f, ok := groupFields[name]
+		if !ok {
+			return nil, fmt.Errorf("group: unknown field %s", name)
+		}
+		g.by = append(g.by, f)
+		fields |= f.fields
+	}
+	for _, agg := range opts.Aggs {
+		g.aggs = append(g.aggs, groupFields[agg.Field])
+		fields |= groupFields[agg.Field].fields
+		res.Aggs = append(res.Aggs, agg.String())
+	}
+	g.keyVals = make([][]string, len(g.by))
+	defer g.removeRuns()
+
+	src, _, err := openSource(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var matcher *Matcher
+	if opts.Query != nil {
+		matcher = opts.Query.NewMatcher()
+	}
+	scanner := newLineScanner(src)
+	var bad []badLine
+	var offset int64
+	var user User
+
+	for ; scanner.Scan(); res.Lines++ {
+		line := scanner.Bytes()
+		lineOffset := offset
+		offset += int64(scanner.size)
+
+		if err := user.DecodeJSONFields(line, fields); err != nil {
+			b, err := opts.Errors.lineError(line, res.Lines+1, lineOffset, err)
+			if err != nil {
+				return nil, err
+			}
+			bad = append(bad, b)
+			continue
+		}
+		if matcher != nil && !matcher.Match(&user, nil) {
+			continue
+		}
+		res.Users++
+		if err := g.add(&user); err != nil {
+			return nil, err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if err := opts.Errors.report(source, bad); err != nil {
+		return nil, err
+	}
+	res.Skipped = len(bad)
+	res.Spills = len(g.runs)
+
+	if err := g.rows(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (g *grouper) userAgent(browser string) UserAgent {
+	ua, ok := g.parsed[browser]
+	if !ok {
+		if len(g.parsed) >= maxParsedAgents {
+			g.parsed = make(map[string]UserAgent)
+		}
+		ua = ParseUserAgent(browser)
+		g.parsed[browser] = ua
+	}
+	return ua
+}
+
+// uniq убирает повторы из короткого списка значений одного пользователя
+func uniq(values []string) []string {
+	out := values[:0]
+	for _, v := range values {
+		if !containsString(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (g *grouper) add(u *User) error {
+	for i, f := range g.by {
+		g.keyVals[i] = uniq(f.values(g, u, g.keyVals[i][:0]))
+	}
+
+	// ключи групп пользователя - все сочетания значений полей группировки
+	g.keys = append(g.keys[:0], "")
+	for i, vals := range g.keyVals {
+		n := len(g.keys)
+		for _, prefix := range g.keys[:n] {
+			for _, v := range vals {
+				if i > 0 {
+					v = prefix + "\x00" + v
+				}
+				g.keys = append(g.keys, v)
+			}
+		}
+		g.keys = g.keys[n:]
+	}
+
+	for _, key := range g.keys {
+		st, ok := g.groups[key]
+		if !ok {
+			st = &groupState{values: make([]map[string]int, len(g.aggs))}
+			for i := range st.values {
+				st.values[i] = make(map[string]int)
+			}
+			g.groups[key] = st
+			g.mem += int64(len(key)) + groupOverhead
+		}
+		st.users++
+	}
+
+	for i, f := range g.aggs {
+		g.aggVals = uniq(f.values(g, u, g.aggVals[:0]))
+		for _, key := range g.keys {
+			counts := g.groups[key].values[i]
+			for _, v := range g.aggVals {
+				if counts[v] == 0 {
+					g.mem += int64(len(v)) + valueOverhead
+				}
+				counts[v]++
+			}
+		}
+	}
+
+	if g.mem > g.opts.MaxMemory {
+		return g.spill()
+	}
+	return nil
+}
+
+func (g *grouper) sortedKeys() []string {
+	keys := make([]string, 0, len(g.groups))
+	for key := range g.groups {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// spill пишет группы в файл, отсортированными по ключу, и освобождает память.
+// Запись: ключ, число пользователей, для каждой агрегации число значений и пары значение - число.
+// Числа - uvarint, строки - uvarint длина и байты, как в снапшоте
+func (g *grouper) spill() error {
+	file, err := os.CreateTemp(g.opts.TempDir, "hw3-group-*.run")
+	if err != nil {
+		return err
+	}
+	g.runs = append(g.runs, file.Name())
+
+	s := &snapshotWriter{w: bufio.NewWriter(file)}
+	for _, key := range g.sortedKeys() {
+		st := g.groups[key]
+		s.string(key)
+		s.uvarint(uint64(st.users))
+		for _, counts := range st.values {
+			s.uvarint(uint64(len(counts)))
+			for v, n := range counts {
+				s.string(v)
+				s.uvarint(uint64(n))
+			}
+		}
+	}
+	if err := s.w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	g.groups = make(map[string]*groupState)
+	g.mem = 0
+	return nil
+}
+
+func (g *grouper) removeRuns() {
+	for _, path := range g.runs {
+		os.Remove(path)
+	}
+}
+
+// groupRun - отсортированный по ключу поток групп: сброшенный на диск или оставшийся в памяти
+type groupRun interface {
+	next() (key string, st *groupState, err error)
+}
+
+type memoryRun struct {
+	g    *grouper
+	keys []string
+}
+
+func (r *memoryRun) next() (string, *groupState, error) {
+	if len(r.keys) == 0 {
+		return "", nil, io.EOF
+	}
+	key := r.keys[0]
+	r.keys = r.keys[1:]
+	return key, r.g.groups[key], nil
+}
+
+type fileRun struct {
+	r    *bufio.Reader
+	aggs int
+}
+
+func (r *fileRun) string() (string, error) {
+	n, err := binary.ReadUvarint(r.r)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, n)
+	_, err = io.ReadFull(r.r, buf)
+	return string(buf), err
+}
+
+func (r *fileRun) next() (string, *groupState, error) {
+	key, err := r.string()
+	if err != nil {
+		return "", nil, err
+	}
+
+	st := &groupState{values: make([]map[string]int, r.aggs)}
+	users, err := binary.ReadUvarint(r.r)
+	st.users = int(users)
+	for i := range st.values {
+		if err != nil {
+			break
+		}
+		var n uint64
+		if n, err = binary.ReadUvarint(r.r); err != nil {
+			break
+		}
+		st.values[i] = make(map[string]int, n)
+		for ; n > 0 && err == nil; n-- {
+			var v string
+			var count uint64
+			if v, err = r.string(); err == nil {
+				count, err = binary.ReadUvarint(r.r)
+				st.values[i][v] = int(count)
+			}
+		}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return key, st, err
+}
+
+// runHead - текущая группа потока в куче слияния
+type runHead struct {
+	key string
+	st  *groupState
+	run groupRun
+}
+
+type runHeap []runHead
+
+func (h runHeap) Len() int            { return len(h) }
+func (h runHeap) Less(i, j int) bool  { return h[i].key < h[j].key }
+func (h runHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x interface{}) { *h = append(*h, x.(runHead)) }
+func (h *runHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// topRows - Limit самых больших групп при слиянии: куча с самой маленькой из оставленных групп наверху.
+// Группы приходят по возрастанию ключа, при равном числе пользователей остаётся группа с меньшим ключом
+type topRows []keyedRow
+
+type keyedRow struct {
+	key string
+	row GroupRow
+}
+
+func (h topRows) Len() int { return len(h) }
+func (h topRows) Less(i, j int) bool {
+	if h[i].row.Users != h[j].row.Users {
+		return h[i].row.Users < h[j].row.Users
+	}
+	return h[i].key > h[j].key
+}
+func (h topRows) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *topRows) Push(x interface{}) { *h = append(*h, x.(keyedRow)) }
+func (h *topRows) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// rows сливает сброшенные на диск части с группами в памяти и превращает состояния в строки результата.
+// Одновременно в памяти состояние только одной группы из каждого потока, а при Limit > 0
+// из строк результата - только Limit самых больших групп
+func (g *grouper) rows(res *GroupResult) error {
+	runs := []groupRun{&memoryRun{g: g, keys: g.sortedKeys()}}
+	for _, path := range g.runs {
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		runs = append(runs, &fileRun{r: bufio.NewReader(file), aggs: len(g.aggs)})
+	}
+
+	h := &runHeap{}
+	push := func(run groupRun) error {
+		key, st, err := run.next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		heap.Push(h, runHead{key, st, run})
+		return nil
+	}
+	for _, run := range runs {
+		if err := push(run); err != nil {
+			return err
+		}
+	}
+
+	top := &topRows{}
+	for h.Len() > 0 {
+		head := heap.Pop(h).(runHead)
+		if err := push(head.run); err != nil {
+			return err
+		}
+		for h.Len() > 0 && (*h)[0].key == head.key {
+			same := heap.Pop(h).(runHead)
+			head.st.merge(same.st)
+			if err := push(same.run); err != nil {
+				return err
+			}
+		}
+
+		switch {
+		case g.opts.Limit <= 0:
+			res.Rows = append(res.Rows, g.row(head.key, head.st))
+		case top.Len() < g.opts.Limit:
+			heap.Push(top, keyedRow{head.key, g.row(head.key, head.st)})
+		case head.st.users > (*top)[0].row.Users:
+			(*top)[0] = keyedRow{head.key, g.row(head.key, head.st)}
+			heap.Fix(top, 0)
+		}
+	}
+
+	if g.opts.Limit > 0 {
+		sort.Slice(*top, func(i, j int) bool { return top.Less(j, i) })
+		for _, r := range *top {
+			res.Rows = append(res.Rows, r.row)
+		}
+		return nil
+	}
+	// строки уже идут по возрастанию ключа, устойчивая сортировка сохраняет его при равном числе пользователей
+	sort.SliceStable(res.Rows, func(i, j int) bool {
+		return res.Rows[i].Users > res.Rows[j].Users
+	})
+	return nil
+}
+
+func (g *grouper) row(key string, st *groupState) GroupRow {
+	row := GroupRow{Keys: strings.Split(key, "\x00"), Users: st.users}
+	for i := range row.Keys {
+		row.Keys[i] = g.redact.field(g.opts.By[i], row.Keys[i])
+	}
+	for i, agg := range g.opts.Aggs {
+		counts := st.values[i]
+		if agg.Kind == AggDistinct {
+			row.Values = append(row.Values, GroupValue{Distinct: len(counts)})
+			continue
+		}
+
+		top := make([]TopValue, 0, len(counts))
+		for v, n := range counts {
+			top = append(top, TopValue{g.redact.field(agg.Field, v), n})
+		}
+		sort.Slice(top, func(i, j int) bool {
+			if top[i].Users != top[j].Users {
+				return top[i].Users > top[j].Users
+			}
+			return top[i].Value < top[j].Value
+		})
+		if len(top) > agg.K {
+			top = top[:agg.K]
+		}
+		row.Values = append(row.Values, GroupValue{Top: top})
+	}
+	return row
+}
+
+// columns - заголовок таблицы и значения строки для текстового вывода и CSV
+func (r *GroupResult) columns() []string {
+	return append(append(append([]string(nil), r.By...), "users"), r.Aggs...)
+}
+
+func (r *GroupResult) cells(row GroupRow) []string {
+	cells := append(append([]string(nil), row.Keys...), strconv.Itoa(row.Users))
+	for _, v := range row.Values {
+		if v.Top == nil {
+			cells = append(cells, strconv.Itoa(v.Distinct))
+			continue
+		}
+		top := make([]string, len(v.Top))
+		for i, t := range v.Top {
+			top[i] = fmt.Sprintf("%s=%d", t.Value, t.Users)
+		}
+		cells = append(cells, strings.Join(top, "|"))
+	}
+	return cells
+}
+
+func (r *GroupResult) WriteText(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(r.columns(), "\t"))
+	for _, row := range r.Rows {
+		fmt.Fprintln(w, strings.Join(r.cells(row), "\t"))
+	}
+	fmt.Fprintf(w, "total users\t%d\n", r.Users)
+	if r.Skipped > 0 {
+		fmt.Fprintf(w, "skipped malformed lines\t%d\n", r.Skipped)
+	}
+	return w.Flush()
+}
+
+func (r *GroupResult) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+// WriteCSV пишет заголовок и строки групп, значения top - "значение=число" через "|".
+// Итог идёт последней строкой-комментарием, как у csv-вывода поиска
+func (r *GroupResult) WriteCSV(out io.Writer) error {
+	w := csv.NewWriter(out)
+	w.Write(r.columns())
+	for _, row := range r.Rows {
+		w.Write(r.cells(row))
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(out, "# lines=%d users=%d skipped=%d\n", r.Lines, r.Users, r.Skipped)
+	return err
+}
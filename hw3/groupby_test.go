@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAggregations(t *testing.T) {
+	aggs, err := ParseAggregations("count, distinct(browser),top(family, 3)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Aggregation{{Kind: AggDistinct, Field: "browser"}, {Kind: AggTop, Field: "family", K: 3}}
+	if !reflect.DeepEqual(aggs, expected) {
+		t.Errorf("got %+v, expected %+v", aggs, expected)
+	}
+
+	for _, bad := range []string{"sum(browser)", "top(family)", "top(family,0)", "distinct(salary)", "distinct"} {
+		if _, err := ParseAggregations(bad); err == nil {
+			t.Errorf("%s: expected error", bad)
+		}
+	}
+}
+
+func groupUsersFile(t *testing.T, opts GroupOptions) *GroupResult {
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	res, err := GroupUsers(file, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return res
+}
+
+func TestGroupUsersMatchesReport(t *testing.T) {
+	res := groupUsersFile(t, GroupOptions{By: []string{"country", "family"}, Query: defaultQuery})
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	report, err := BuildReport(file, ReportCountryBrowser, defaultQuery, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if res.Users != report.Users || len(res.Rows) != len(report.Rows) {
+		t.Fatalf("got %d users in %d groups, report has %d in %d", res.Users, len(res.Rows), report.Users, len(report.Rows))
+	}
+	for i, row := range report.Rows {
+		if !reflect.DeepEqual(res.Rows[i].Keys, row.Keys) || res.Rows[i].Users != row.Users {
+			t.Errorf("row %d: got %+v, expected %+v", i, res.Rows[i], row)
+		}
+	}
+}
+
+func TestGroupUsersSpill(t *testing.T) {
+	aggs, err := ParseAggregations("distinct(browser),top(os,2)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := GroupOptions{By: []string{"family"}, Aggs: aggs}
+	expected := groupUsersFile(t, opts)
+	if expected.Spills != 0 {
+		t.Fatalf("unexpected spills with default memory: %d", expected.Spills)
+	}
+
+	dir := t.TempDir()
+	opts.MaxMemory = 4 << 10
+	opts.TempDir = dir
+	got := groupUsersFile(t, opts)
+	if got.Spills == 0 {
+		t.Fatal("expected spills with a small memory limit")
+	}
+	if !reflect.DeepEqual(got.Rows, expected.Rows) {
+		t.Errorf("spilled result differs\ngot:      %+v\nexpected: %+v", got.Rows, expected.Rows)
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*")); len(files) != 0 {
+		t.Errorf("spill files left: %v", files)
+	}
+}
+
+func TestGroupUsersOutput(t *testing.T) {
+	input := `{"browsers":["Opera/9.80","Mozilla/5.0 (Android)"],"company":"Flashpoint","country":"Chile","name":"a"}
+{"browsers":["Opera/9.80"],"company":"Flashpoint","country":"Kenya","name":"b"}
+{broken
+{"browsers":["Mozilla/4.0 (compatible; MSIE 7.0)"],"company":"Muxo","country":"Chile","name":"c"}`
+
+	aggs, _ := ParseAggregations("distinct(country),top(browser,1)")
+	res, err := GroupUsers(strings.NewReader(input), GroupOptions{By: []string{"company"}, Aggs: aggs, Errors: ErrorPolicy{Mode: ErrorSkip}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Lines != 4 || res.Users != 3 || res.Skipped != 1 {
+		t.Errorf("unexpected totals %+v", res)
+	}
+
+	out := new(bytes.Buffer)
+	if err := res.WriteCSV(out); err != nil {
+		t.Fatal(err)
+	}
+	r := csv.NewReader(out)
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"company", "users", "distinct(country)", "top(browser,1)"},
+		{"Flashpoint", "2", "2", "Opera/9.80=2"},
+		{"Muxo", "1", "1", "Mozilla/4.0 (compatible; MSIE 7.0)=1"},
+	}
+	if !reflect.DeepEqual(records, expected) {
+		t.Errorf("got %q, expected %q", records, expected)
+	}
+
+	if _, err := GroupUsers(strings.NewReader(input), GroupOptions{By: []string{"company"}}); err == nil {
+		t.Error("expected error for a broken line in strict mode")
+	}
+}
+
+func TestGroupUsersRedaction(t *testing.T) {
+	input := `{"browsers":["Opera"],"email":"sharon@muxo.com","name":"Sharon Crawford","phone":"176-88-49"}
+{"browsers":["Opera"],"email":"sharon@muxo.com","name":"Susan Ellis","phone":"176-88-49"}`
+
+	aggs, _ := ParseAggregations("top(name,2)")
+	opts := GroupOptions{By: []string{"email", "phone"}, Aggs: aggs}
+	res, err := GroupUsers(strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// по умолчанию email скрывается так же, как в выводе поиска
+	if keys := res.Rows[0].Keys; keys[0] != "sharon [at] muxo.com" || keys[1] != "176-88-49" {
+		t.Errorf("default policy: unexpected keys %q", keys)
+	}
+
+	opts.Redaction = RedactionPolicy{Email: RedactMask, Name: RedactNameInitials, Phone: RedactDrop}
+	res, err = GroupUsers(strings.NewReader(input), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []GroupRow{{
+		Keys:   []string{"s***@muxo.com", ""},
+		Users:  2,
+		Values: []GroupValue{{Top: []TopValue{{"S. C.", 1}, {"S. E.", 1}}}},
+	}}
+	if !reflect.DeepEqual(res.Rows, expected) {
+		t.Errorf("got %+v, expected %+v", res.Rows, expected)
+	}
+
+	opts.Redaction = RedactionPolicy{Email: "rot13"}
+	if _, err := GroupUsers(strings.NewReader(input), opts); err == nil {
+		t.Error("expected error for a bad redaction policy")
+	}
+}
+
+func TestGroupUsersLimit(t *testing.T) {
+	aggs, _ := ParseAggregations("distinct(browser)")
+	opts := GroupOptions{By: []string{"browser"}, Aggs: aggs, TempDir: t.TempDir()}
+	all := groupUsersFile(t, opts)
+
+	for _, limit := range []int{1, 5, 50, len(all.Rows) + 1} {
+		for _, memory := range []int64{0, 4 << 10} {
+			opts.Limit, opts.MaxMemory = limit, memory
+			got := groupUsersFile(t, opts)
+			expected := all.Rows
+			if len(expected) > limit {
+				expected = expected[:limit]
+			}
+			if !reflect.DeepEqual(got.Rows, expected) {
+				t.Errorf("limit %d, memory %d: got %+v, expected %+v", limit, memory, got.Rows, expected)
+			}
+		}
+	}
+}
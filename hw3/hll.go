@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+)
+
+const (
+	MinHLLPrecision = 4
+	MaxHLLPrecision = 18
+)
+
+// HyperLogLog - приблизительный счётчик уникальных строк в фиксированной памяти: 2^precision байт.
+// Стандартная ошибка оценки 1.04/sqrt(2^precision): 1.6% при precision 12, 0.4% при 16.
+// Счётчики с одинаковой точностью можно объединять, результат как у одного счётчика по всем строкам
+type HyperLogLog struct {
+	p    uint8
+	regs []uint8
+}
+
+func NewHyperLogLog(precision uint8) (*HyperLogLog, error) {
+	if precision < MinHLLPrecision || precision > MaxHLLPrecision {
+		return nil, fmt.Errorf("hyperloglog: precision must be in [%d, %d], got %d", MinHLLPrecision, MaxHLLPrecision, precision)
+	}
+	return &HyperLogLog{p: precision, regs: make([]uint8, 1<<precision)}, nil
+}
+
+// hash64 - fnv-1a с перемешиванием из splitmix64: у голого fnv плохо распределены старшие биты
+func hash64(s string) uint64 {
+	x := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		x ^= uint64(s[i])
+		x *= 1099511628211
+	}
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func (h *HyperLogLog) Add(s string) {
+	x := hash64(s)
+	idx := x >> (64 - h.p)
+	// ранг - позиция первой единицы в оставшихся битах, сторожевой бит ограничивает его 64-p+1
+	rank := uint8(bits.LeadingZeros64(x<<h.p|1<<(h.p-1))) + 1
+	if rank > h.regs[idx] {
+		h.regs[idx] = rank
+	}
+}
+
+func (h *HyperLogLog) Merge(other *HyperLogLog) error {
+	if h.p != other.p {
+		return fmt.Errorf("hyperloglog: cannot merge precision %d into %d", other.p, h.p)
+	}
+	for i, r := range other.regs {
+		if r > h.regs[i] {
+			h.regs[i] = r
+		}
+	}
+	return nil
+}
+
+// Estimate - оценка числа уникальных строк, для малых значений используется linear counting
+func (h *HyperLogLog) Estimate() uint64 {
+	m := float64(len(h.regs))
+	var sum float64
+	zeros := 0
+	for _, r := range h.regs {
+		sum += 1 / float64(uint64(1)<<r)
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	var alpha float64
+	switch len(h.regs) {
+	case 16:
+		alpha = 0.673
+	case 32:
+		alpha = 0.697
+	case 64:
+		alpha = 0.709
+	default:
+		alpha = 0.7213 / (1 + 1.079/m)
+	}
+
+	estimate := alpha * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// StdError - относительная стандартная ошибка оценки
+func (h *HyperLogLog) StdError() float64 {
+	return 1.04 / math.Sqrt(float64(len(h.regs)))
+}
+
+// browserCounter считает уникальные браузеры найденных пользователей: точно или через HyperLogLog
+type browserCounter interface {
+	Add(browser string)
+	Count() int
+	// StdError - 0 для точного подсчёта
+	StdError() float64
+}
+
+type exactBrowsers map[string]struct{}
+
+func (s exactBrowsers) Add(browser string) {
+	s[browser] = struct{}{}
+}
+
+func (s exactBrowsers) Count() int {
+	return len(s)
+}
+
+func (s exactBrowsers) StdError() float64 {
+	return 0
+}
+
+// ownedBrowsers - exactBrowsers для строк, заимствованных у отображённого файла: новые ключи копируются
+type ownedBrowsers struct {
+	exactBrowsers
+}
+
+func (s ownedBrowsers) Add(browser string) {
+	if _, ok := s.exactBrowsers[browser]; !ok {
+		s.exactBrowsers[cloneString(browser)] = struct{}{}
+	}
+}
+
+type approxBrowsers struct {
+	*HyperLogLog
+}
+
+func (a approxBrowsers) Count() int {
+	return int(a.Estimate())
+}
+
+func newBrowserCounter(opts ScanOptions) (browserCounter, error) {
+	if opts.Precision == 0 {
+		return make(exactBrowsers), nil
+	}
+	hll, err := NewHyperLogLog(opts.Precision)
+	if err != nil {
+		return nil, err
+	}
+	return approxBrowsers{hll}, nil
+}
+
+// mergeBrowsers добавляет src в dst, оба созданы newBrowserCounter с одними и теми же опциями
+func mergeBrowsers(dst, src browserCounter) {
+	switch dst := dst.(type) {
+	case exactBrowsers:
+		for browser := range src.(exactBrowsers) {
+			dst[browser] = struct{}{}
+		}
+	case approxBrowsers:
+		dst.Merge(src.(approxBrowsers).HyperLogLog)
+	}
+}
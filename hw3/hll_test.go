@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestHyperLogLogEstimate(t *testing.T) {
+	for _, p := range []uint8{10, 14} {
+		for _, n := range []int{100, 10000, 200000} {
+			h, err := NewHyperLogLog(p)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < n; i++ {
+				// повторы не должны влиять на оценку
+				h.Add("browser " + strconv.Itoa(i))
+				h.Add("browser " + strconv.Itoa(i/2))
+			}
+
+			relErr := math.Abs(float64(h.Estimate())-float64(n)) / float64(n)
+			if relErr > 4*h.StdError() {
+				t.Errorf("p=%d n=%d: estimate %d is off by %.2f%%, std error %.2f%%", p, n, h.Estimate(), relErr*100, h.StdError()*100)
+			}
+		}
+	}
+
+	if _, err := NewHyperLogLog(MaxHLLPrecision + 1); err == nil {
+		t.Error("expected error for too high precision")
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	whole, _ := NewHyperLogLog(12)
+	parts := make([]*HyperLogLog, 4)
+	for i := range parts {
+		parts[i], _ = NewHyperLogLog(12)
+	}
+	for i := 0; i < 50000; i++ {
+		s := "ua-" + strconv.Itoa(i)
+		whole.Add(s)
+		parts[i%len(parts)].Add(s)
+	}
+
+	merged, _ := NewHyperLogLog(12)
+	for _, part := range parts {
+		if err := merged.Merge(part); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if merged.Estimate() != whole.Estimate() {
+		t.Errorf("merged estimate %d differs from single counter %d", merged.Estimate(), whole.Estimate())
+	}
+
+	other, _ := NewHyperLogLog(10)
+	if err := merged.Merge(other); err == nil {
+		t.Error("expected error merging different precisions")
+	}
+}
+
+func TestApproxSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	writeBrokenUsers(t, path, 1000, nil, "")
+	opts := ScanOptions{Precision: 12}
+
+	// регистры объединяются без потерь, поэтому оценка не зависит от разбиения на куски
+	var outputs []string
+	for _, workers := range []int{0, 1, 5} {
+		out := new(bytes.Buffer)
+		var err error
+		if workers == 0 {
+			err = SearchFiles(NewTextWriter(out), []string{path}, defaultQuery, nil, opts)
+		} else {
+			err = parallelSearchFile(NewTextWriter(out), path, defaultQuery, workers, opts)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		outputs = append(outputs, out.String())
+	}
+	if outputs[0] != outputs[1] || outputs[0] != outputs[2] {
+		t.Errorf("approximate results differ between chunkings:\n%v", outputs)
+	}
+	if !strings.Contains(outputs[0], "Total unique browsers ~") || !strings.Contains(outputs[0], "std error 1.6%") {
+		t.Errorf("approximate output should state the estimate and its error:\n%v", outputs[0])
+	}
+
+	if err := SearchFiles(NewTextWriter(new(bytes.Buffer)), []string{path}, defaultQuery, nil, ScanOptions{Precision: 2}); err == nil {
+		t.Error("expected error for bad precision")
+	}
+}
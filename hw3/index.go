@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bufio"
+	"encoding/gob"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"time"
+)
+
+// Index - инвертированный индекс по файлу пользователей.
+// Browsers - словарь уникальных браузеров, Postings[id] - номера строк, где встречается браузер id.
+// Trigrams позволяет по подстроке быстро сузить словарь, Families - семейства user-agent -> строки.
+// Offsets[i] - смещение начала строки i, по нему подтягиваются только нужные записи.
+// Bad - номера строк, которые не разобрались (индекс строился не в строгом режиме), по возрастанию
+type Index struct {
+	Source   string
+	Size     int64
+	ModTime  time.Time
+	TailCRC  uint32
+	Offsets  []int64
+	Browsers []string
+	Postings [][]uint32
+	Trigrams map[string][]uint32
+	Families map[string][]uint32
+	Bad      []uint32
+
+	browserIDs      map[string]uint32
+	browserFamilies []string
+}
+
+// tailCRCWindow - сколько байт перед последней строкой проверяется, чтобы убедиться,
+// что файл только дописывался и индекс можно обновить инкрементально
+const tailCRCWindow = 4096
+
+func IndexPath(source string) string {
+	return source + ".idx"
+}
+
+func newIndex(source string) *Index {
+	return &Index{
+		Source:     source,
+		Trigrams:   make(map[string][]uint32),
+		Families:   make(map[string][]uint32),
+		browserIDs: make(map[string]uint32),
+	}
+}
+
+// BuildIndex строит индекс по source. Плохие строки обрабатываются по opts.Errors:
+// в строгом режиме индекс не строится, иначе строки запоминаются в Bad
+func BuildIndex(source string, opts ScanOptions) (*Index, error) {
+	idx := newIndex(source)
+	if err := idx.scanFrom(0, opts); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// OpenIndex загружает индекс из indexPath и при необходимости обновляет его:
+// если файл дописан - дочитывает новые строки, если изменён иначе - перестраивает с нуля.
+// Обновлённый индекс сохраняется обратно
+func OpenIndex(source, indexPath string, opts ScanOptions) (*Index, error) {
+	idx, err := LoadIndex(indexPath)
+	if err != nil || idx.Source != source {
+		idx, err = BuildIndex(source, opts)
+		if err != nil {
+			return nil, err
+		}
+		return idx, idx.Save(indexPath)
+	}
+
+	changed, err := idx.Update(opts)
+	if err != nil {
+		return nil, err
+	}
+	if changed {
+		return idx, idx.Save(indexPath)
+	}
+	return idx, nil
+}
+
+func LoadIndex(indexPath string) (*Index, error) {
+	file, err := os.Open(indexPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	idx := newIndex("")
+	if err := gob.NewDecoder(bufio.NewReader(file)).Decode(idx); err != nil {
+		return nil, fmt.Errorf("cant decode index %s: %w", indexPath, err)
+	}
+
+	for id, browser := range idx.Browsers {
+		idx.browserIDs[browser] = uint32(id)
+		idx.browserFamilies = append(idx.browserFamilies, ParseUserAgent(browser).Family)
+	}
+	return idx, nil
+}
+
+func (idx *Index) Save(indexPath string) error {
+	tmpPath := indexPath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	if err := gob.NewEncoder(w).Encode(idx); err != nil {
+		file.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, indexPath)
+}
+
+// Update приводит индекс в соответствие с файлом. Возвращает true, если индекс изменился
+func (idx *Index) Update(opts ScanOptions) (bool, error) {
+	info, err := os.Stat(idx.Source)
+	if err != nil {
+		return false, err
+	}
+	if info.Size() == idx.Size && info.ModTime().Equal(idx.ModTime) {
+		return false, nil
+	}
+
+	if info.Size() >= idx.Size && len(idx.Offsets) > 0 {
+		lastLine := len(idx.Offsets) - 1
+		crc, err := idx.crcBefore(idx.Offsets[lastLine])
+		if err != nil {
+			return false, err
+		}
+		if crc == idx.TailCRC {
+			// последняя строка могла быть недописана - переиндексируем её вместе с новыми
+			start := idx.Offsets[lastLine]
+			idx.dropLastLine()
+			return true, idx.scanFrom(start, opts)
+		}
+	}
+
+	*idx = *newIndex(idx.Source)
+	return true, idx.scanFrom(0, opts)
+}
+
+func (idx *Index) crcBefore(offset int64) (uint32, error) {
+	file, err := os.Open(idx.Source)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	start := offset - tailCRCWindow
+	if start < 0 {
+		start = 0
+	}
+
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, io.NewSectionReader(file, start, offset-start)); err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+func (idx *Index) dropLastLine() {
+	line := uint32(len(idx.Offsets) - 1)
+	idx.Offsets = idx.Offsets[:line]
+
+	for id, postings := range idx.Postings {
+		if n := len(postings); n > 0 && postings[n-1] == line {
+			idx.Postings[id] = postings[:n-1]
+		}
+	}
+	for family, postings := range idx.Families {
+		if n := len(postings); n > 0 && postings[n-1] == line {
+			idx.Families[family] = postings[:n-1]
+		}
+	}
+	if n := len(idx.Bad); n > 0 && idx.Bad[n-1] == line {
+		idx.Bad = idx.Bad[:n-1]
+	}
+}
+
+func (idx *Index) scanFrom(start int64, opts ScanOptions) error {
+	file, err := os.Open(idx.Source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+
+	scanner := newLineScanner(file)
+	offset := start
+	var user User
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		lineNo := uint32(len(idx.Offsets))
+		idx.Offsets = append(idx.Offsets, offset)
+
+		if err := user.DecodeJSON(line); err != nil {
+			if _, err := opts.Errors.lineError(line, int(lineNo)+1, offset, err); err != nil {
+				return withSource(err, idx.Source)
+			}
+			idx.Bad = append(idx.Bad, lineNo)
+		} else {
+			idx.addUser(lineNo, &user)
+		}
+		offset += int64(scanner.size)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	idx.Size, idx.ModTime = info.Size(), info.ModTime()
+	if len(idx.Offsets) > 0 {
+		crc, err := idx.crcBefore(idx.Offsets[len(idx.Offsets)-1])
+		if err != nil {
+			return err
+		}
+		idx.TailCRC = crc
+	}
+	return nil
+}
+
+func (idx *Index) addUser(line uint32, u *User) {
+	for _, browser := range u.Browsers {
+		id, ok := idx.browserIDs[browser]
+		if !ok {
+			id = uint32(len(idx.Browsers))
+			idx.Browsers = append(idx.Browsers, browser)
+			idx.Postings = append(idx.Postings, nil)
+			idx.browserIDs[browser] = id
+			idx.browserFamilies = append(idx.browserFamilies, ParseUserAgent(browser).Family)
+
+			for _, tri := range trigrams(browser) {
+				idx.Trigrams[tri] = append(idx.Trigrams[tri], id)
+			}
+		}
+		idx.Postings[id] = appendPosting(idx.Postings[id], line)
+
+		family := idx.browserFamilies[id]
+		idx.Families[family] = appendPosting(idx.Families[family], line)
+	}
+}
+
+// appendPosting добавляет строку, не допуская повторов: строки приходят по возрастанию
+func appendPosting(postings []uint32, line uint32) []uint32 {
+	if n := len(postings); n > 0 && postings[n-1] == line {
+		return postings
+	}
+	return append(postings, line)
+}
+
+func trigrams(s string) []string {
+	if len(s) < 3 {
+		return nil
+	}
+
+	seen := make(map[string]struct{}, len(s))
+	result := make([]string, 0, len(s)-2)
+	for i := 0; i+3 <= len(s); i++ {
+		tri := s[i : i+3]
+		if _, ok := seen[tri]; !ok {
+			seen[tri] = struct{}{}
+			result = append(result, tri)
+		}
+	}
+	return result
+}
+
+// candidateBrowsers возвращает id браузеров словаря, удовлетворяющих условию
+func (idx *Index) candidateBrowsers(term browserTerm) []uint32 {
+	var ids []uint32
+
+	if term.op == opContains && len(term.value) >= 3 {
+		lists := make([][]uint32, 0, len(term.value))
+		for _, tri := range trigrams(term.value) {
+			lists = append(lists, idx.Trigrams[tri])
+		}
+		for _, id := range intersectPostings(lists) {
+			if term.match(idx.Browsers[id]) {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	if term.op == opEq {
+		if id, ok := idx.browserIDs[term.value]; ok {
+			ids = append(ids, id)
+		}
+		return ids
+	}
+
+	for id, browser := range idx.Browsers {
+		if term.match(browser) {
+			ids = append(ids, uint32(id))
+		}
+	}
+	return ids
+}
+
+// FamilyLines - номера строк пользователей, у которых есть браузер семейства family
+func (idx *Index) FamilyLines(family string) []uint32 {
+	return idx.Families[family]
+}
+
+// Search отвечает на запрос по индексу и читает с диска только строки-кандидаты.
+// Вывод совпадает с QuerySearch по тому же файлу с теми же opts: плохие строки из Bad
+// в строгом режиме дают *LineError, иначе передаются opts.Errors
+func (idx *Index) Search(w ResultWriter, q *Query, opts ScanOptions) error {
+	seen, err := newBrowserCounter(opts)
+	if err != nil {
+		return err
+	}
+	termLines := make([][]uint32, len(q.browsers))
+
+	for i, term := range q.browsers {
+		var lists [][]uint32
+		for _, id := range idx.candidateBrowsers(term) {
+			seen.Add(idx.Browsers[id])
+			lists = append(lists, idx.Postings[id])
+		}
+		termLines[i] = unionPostings(lists)
+	}
+
+	candidates, _ := idx.candidates(q.root, termLines)
+
+	file, err := os.Open(idx.Source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	matcher := q.NewMatcher()
+	fields := opts.decodeFields(q)
+	var found []FoundUser
+	var bad []badLine
+	var user User
+	var buf []byte
+
+	// плохие строки проверяются все, как при полном проходе, а не только среди кандидатов
+	for _, line := range idx.Bad {
+		buf, err = idx.readLine(file, line, buf)
+		if err != nil {
+			return err
+		}
+		b, err := opts.Errors.lineError(buf, int(line)+1, idx.Offsets[line], user.DecodeJSON(buf))
+		if err != nil {
+			return withSource(err, idx.Source)
+		}
+		bad = append(bad, b)
+	}
+
+	nextBad := 0
+	for _, line := range candidates {
+		for nextBad < len(idx.Bad) && idx.Bad[nextBad] < line {
+			nextBad++
+		}
+		if nextBad < len(idx.Bad) && idx.Bad[nextBad] == line {
+			continue
+		}
+
+		buf, err = idx.readLine(file, line, buf)
+		if err != nil {
+			return err
+		}
+		if err := user.DecodeJSONFields(buf, fields); err != nil {
+			return &LineError{Source: idx.Source, Line: int(line) + 1, Offset: idx.Offsets[line], Err: err}
+		}
+		if matcher.Match(&user, nil) {
+			found = append(found, newFoundUser(int(line), &user, matcher))
+		}
+	}
+
+	if err := opts.Errors.report(idx.Source, bad); err != nil {
+		return err
+	}
+	res := scanResult{found: found, seen: seen, lines: len(idx.Offsets), bad: bad}
+	return writeAll(w, found, res.stats())
+}
+
+func (idx *Index) readLine(r io.ReaderAt, line uint32, buf []byte) ([]byte, error) {
+	start := idx.Offsets[line]
+	end := idx.Size
+	if int(line)+1 < len(idx.Offsets) {
+		end = idx.Offsets[line+1] - 1
+	}
+
+	if cap(buf) < int(end-start) {
+		buf = make([]byte, end-start)
+	}
+	buf = buf[:end-start]
+
+	if _, err := r.ReadAt(buf, start); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return dropCR(buf), nil
+}
+
+// candidates вычисляет по дереву запроса надмножество подходящих строк.
+// exact = false, если в поддереве есть условия, которые по индексу не проверить
+func (idx *Index) candidates(node queryNode, termLines [][]uint32) ([]uint32, bool) {
+	switch n := node.(type) {
+	case browserNode:
+		return termLines[n.term], true
+	case andNode:
+		left, leftExact := idx.candidates(n.left, termLines)
+		right, rightExact := idx.candidates(n.right, termLines)
+		return intersectPostings([][]uint32{left, right}), leftExact && rightExact
+	case orNode:
+		left, leftExact := idx.candidates(n.left, termLines)
+		right, rightExact := idx.candidates(n.right, termLines)
+		return unionPostings([][]uint32{left, right}), leftExact && rightExact
+	case notNode:
+		inner, exact := idx.candidates(n.inner, termLines)
+		if !exact {
+			return idx.allLines(), false
+		}
+		return idx.complement(inner), true
+	default:
+		return idx.allLines(), false
+	}
+}
+
+func (idx *Index) allLines() []uint32 {
+	lines := make([]uint32, len(idx.Offsets))
+	for i := range lines {
+		lines[i] = uint32(i)
+	}
+	return lines
+}
+
+func (idx *Index) complement(lines []uint32) []uint32 {
+	result := make([]uint32, 0, len(idx.Offsets)-len(lines))
+	j := 0
+	for i := uint32(0); i < uint32(len(idx.Offsets)); i++ {
+		if j < len(lines) && lines[j] == i {
+			j++
+			continue
+		}
+		result = append(result, i)
+	}
+	return result
+}
+
+func intersectPostings(lists [][]uint32) []uint32 {
+	if len(lists) == 0 {
+		return nil
+	}
+	sort.Slice(lists, func(i, j int) bool { return len(lists[i]) < len(lists[j]) })
+
+	result := append([]uint32(nil), lists[0]...)
+	for _, list := range lists[1:] {
+		merged := result[:0]
+		i, j := 0, 0
+		for i < len(result) && j < len(list) {
+			switch {
+			case result[i] < list[j]:
+				i++
+			case result[i] > list[j]:
+				j++
+			default:
+				merged = append(merged, result[i])
+				i++
+				j++
+			}
+		}
+		result = merged
+	}
+	return result
+}
+
+func unionPostings(lists [][]uint32) []uint32 {
+	set := make(map[uint32]struct{})
+	for _, list := range lists {
+		for _, line := range list {
+			set[line] = struct{}{}
+		}
+	}
+
+	result := make([]uint32, 0, len(set))
+	for line := range set {
+		result = append(result, line)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func copyUsersFile(t *testing.T, lines int) string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines > 0 {
+		data = []byte(strings.Join(strings.Split(string(data), "\n")[:lines], "\n"))
+	}
+
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func checkIndexSearch(t *testing.T, idx *Index, exprs ...string) {
+	t.Helper()
+	checkIndexSearchOpts(t, idx, ScanOptions{}, exprs...)
+}
+
+func checkIndexSearchOpts(t *testing.T, idx *Index, opts ScanOptions, exprs ...string) {
+	t.Helper()
+	for _, expr := range exprs {
+		q := MustCompileQuery(expr)
+
+		expected := new(bytes.Buffer)
+		if err := SearchFiles(NewTextWriter(expected), []string{idx.Source}, q, nil, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		got := new(bytes.Buffer)
+		if err := idx.Search(NewTextWriter(got), q, opts); err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != expected.String() {
+			t.Errorf("%s: results not match\nGot:\n%v\nExpected:\n%v", expr, got, expected)
+		}
+	}
+}
+
+func TestIndexSearch(t *testing.T) {
+	path := copyUsersFile(t, 0)
+	idx, err := OpenIndex(path, IndexPath(path), ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkIndexSearch(t, idx,
+		DefaultQueryExpr,
+		`browser~"Android" AND NOT browser~"MSIE"`,
+		`browser~"MS" OR country="Chile"`,
+		`NOT browser~"Mozilla"`,
+		`browser="Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1"`,
+	)
+
+	if len(idx.FamilyLines("IE")) == 0 {
+		t.Errorf("expected IE users in family index")
+	}
+}
+
+func TestIndexIncrementalUpdate(t *testing.T) {
+	full, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(full), "\n")
+
+	path := copyUsersFile(t, 500)
+	indexPath := IndexPath(path)
+	if _, err := OpenIndex(path, indexPath, ScanOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString("\n" + strings.Join(lines[500:], "\n"))
+	file.Close()
+
+	idx, err := OpenIndex(path, indexPath, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Offsets) != len(lines) {
+		t.Errorf("expected %d lines after update, got %d", len(lines), len(idx.Offsets))
+	}
+	checkIndexSearch(t, idx, DefaultQueryExpr)
+
+	// перезапись файла целиком - индекс перестраивается
+	if err := os.WriteFile(path, []byte(strings.Join(lines[100:300], "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	idx, err = OpenIndex(path, indexPath, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Offsets) != 200 {
+		t.Errorf("expected 200 lines after rebuild, got %d", len(idx.Offsets))
+	}
+	checkIndexSearch(t, idx, DefaultQueryExpr)
+}
+
+func TestIndexErrorPolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	lines := writeBrokenUsers(t, path, 500, []int{3, 200}, "{broken")
+	indexPath := IndexPath(path)
+
+	if _, err := OpenIndex(path, indexPath, ScanOptions{}); err == nil {
+		t.Fatal("expected strict error for a malformed line")
+	}
+
+	skip := ScanOptions{Errors: ErrorPolicy{Mode: ErrorSkip}}
+	idx, err := OpenIndex(path, indexPath, skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Bad) != 2 || len(idx.Offsets) != 500 {
+		t.Fatalf("expected 2 bad of 500 lines, got %v of %d", idx.Bad, len(idx.Offsets))
+	}
+
+	approx := skip
+	approx.Precision = 10
+	fields, err := ParseFields("name,phone")
+	if err != nil {
+		t.Fatal(err)
+	}
+	projected := skip
+	projected.Fields = fieldsMask(fields)
+	for _, opts := range []ScanOptions{skip, approx, projected} {
+		checkIndexSearchOpts(t, idx, opts, DefaultQueryExpr, `NOT browser~"Mozilla"`)
+	}
+
+	var quarantine bytes.Buffer
+	var skipped []int
+	policy := ErrorPolicy{Mode: ErrorQuarantine, Quarantine: &quarantine, OnSkip: func(err *LineError) { skipped = append(skipped, err.Line) }}
+	if err := idx.Search(NewTextWriter(new(bytes.Buffer)), defaultQuery, ScanOptions{Errors: policy}); err != nil {
+		t.Fatal(err)
+	}
+	if quarantine.String() != "{broken\n{broken\n" || len(skipped) != 2 || skipped[0] != 4 || skipped[1] != 201 {
+		t.Errorf("unexpected quarantine %q, skipped %v", quarantine.String(), skipped)
+	}
+
+	// индекс с плохими строками в строгом режиме отвечает ошибкой, как и полный проход
+	var lerr *LineError
+	if err := idx.Search(NewTextWriter(new(bytes.Buffer)), defaultQuery, ScanOptions{}); !errors.As(err, &lerr) || lerr.Line != 4 {
+		t.Errorf("expected strict error at line 4, got %v", err)
+	}
+
+	// недописанная последняя строка пропускается, а после дописывания индексируется
+	full := strings.Join(lines, "\n") + "\n" + lines[10]
+	if err := os.WriteFile(path, []byte(full[:len(full)-5]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err = OpenIndex(path, indexPath, skip); err != nil || len(idx.Bad) != 3 {
+		t.Fatalf("expected partial line to be bad, got %v, %v", idx, err)
+	}
+	if err := os.WriteFile(path, []byte(full), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if idx, err = OpenIndex(path, indexPath, skip); err != nil || len(idx.Bad) != 2 || len(idx.Offsets) != 501 {
+		t.Fatalf("expected completed line to be indexed, got %v, %v", idx, err)
+	}
+	checkIndexSearchOpts(t, idx, skip, DefaultQueryExpr)
+}
+
+func TestIndexCRLF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	lines := writeBrokenUsers(t, path, 200, []int{150}, "{broken")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\r\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var offsets []int64
+	var offset int64
+	for _, line := range lines {
+		offsets = append(offsets, offset)
+		offset += int64(len(line)) + 2
+	}
+
+	// смещение в ошибке считается по байтам файла при любом способе чтения
+	for _, opts := range []ScanOptions{{}, {Mmap: true}, {Workers: 4}} {
+		var lerr *LineError
+		err := SearchFiles(NewTextWriter(new(bytes.Buffer)), []string{path}, defaultQuery, nil, opts)
+		if !errors.As(err, &lerr) || lerr.Line != 151 || lerr.Offset != offsets[150] {
+			t.Errorf("%+v: expected error at line 151, offset %d, got %v", opts, offsets[150], err)
+		}
+	}
+	var lerr *LineError
+	if _, err := OpenIndex(path, IndexPath(path), ScanOptions{}); !errors.As(err, &lerr) || lerr.Offset != offsets[150] {
+		t.Errorf("index: expected error at offset %d, got %v", offsets[150], err)
+	}
+
+	skip := ScanOptions{Errors: ErrorPolicy{Mode: ErrorSkip}}
+	idx, err := OpenIndex(path, IndexPath(path), skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(idx.Offsets) != len(offsets) {
+		t.Fatalf("expected %d offsets, got %d", len(offsets), len(idx.Offsets))
+	}
+	for i := range offsets {
+		if idx.Offsets[i] != offsets[i] {
+			t.Fatalf("line %d: expected offset %d, got %d", i+1, offsets[i], idx.Offsets[i])
+		}
+	}
+	checkIndexSearchOpts(t, idx, skip, DefaultQueryExpr, `NOT browser~"Mozilla"`)
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// hw3 <command> [flags]
+//
+//	group    - агрегаты по группам пользователей: число, разные значения, самые частые значения
+//	generate - записать синтетический users.txt заданного размера
+//	index    - построить или обновить индекс по файлу пользователей
+//	search   - найти пользователей по запросу
+//	serve    - HTTP-сервис поиска по файлу, загруженному в память
+//	snapshot - сохранить бинарный снапшот файла пользователей для быстрых повторных поисков
+//	report   - отчёты по браузерам: семейства, ОС, страны
+//	tail     - следить за дописываемым файлом и печатать новых найденных пользователей
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"group":    {"group -by fields [-agg list] [-q query] [-limit n] [-format text|json|csv] [-max-memory MiB] [-tmp dir] [-on-error mode] [-quarantine file] [-raw-email] [-redact-* mode] [-redact-config file] [users_file]", runGroup},
+	"generate": {"generate [-n lines] [-seed n] [-android share] [-msie share] [-browsers n] [-o file]", runGenerate},
+	"index":    {"index [-o index_file] [-on-error mode] [-quarantine file] [users_file]", runIndex},
+	"report":   {"report [-kind families|os|country-browser] [-top n] [-format text|json] [-q query] [users_file]", runReport},
+	"search":   {"search [-q query] [-index] [-mmap] [-parallel n] [-approx p] [-format f] [-fields list] [-raw-email] [-redact-* mode] [-redact-config file] [-on-error mode] [-quarantine file] [-progress] [users_file|glob...]", runSearch},
+	"serve":    {"serve [-addr host:port] [-interval duration] [-raw-email] [-redact-* mode] [-redact-config file] [users_file]", runServe},
+	"snapshot": {"snapshot [-o snapshot_file] [users_file]", runSnapshot},
+	"tail":     {"tail [-q query] [-n] [-interval duration] [-format f] [-fields list] [-raw-email] [-redact-* mode] [-redact-config file] [-on-error mode] [-quarantine file] [users_file]", runTail},
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		printUsage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage:")
+	for _, name := range commandNames() {
+		fmt.Fprintln(os.Stderr, "  hw3", commands[name].usage)
+	}
+}
+
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sourceArg(fs *flag.FlagSet) string {
+	if fs.NArg() > 0 {
+		return fs.Arg(0)
+	}
+	return filePath
+}
+
+// resultFlags добавляет флаги формата вывода, выбора полей и скрытия персональных данных,
+// возвращённая функция создаёт ResultWriter после fs.Parse и возвращает маску выбранных полей
+func resultFlags(fs *flag.FlagSet) func() (ResultWriter, UserFields, error) {
+	format := fs.String("format", FormatText, "output format: text, json, ndjson or csv")
+	list := fs.String("fields", "", "comma-separated fields to print, e.g. name,phone; default name,email,browsers")
+	newPolicy := redactionFlags(fs)
+
+	return func() (ResultWriter, UserFields, error) {
+		fields, err := ParseFields(*list)
+		if err != nil {
+			return nil, 0, err
+		}
+		policy, err := newPolicy()
+		if err != nil {
+			return nil, 0, err
+		}
+		w, err := NewResultWriter(*format, os.Stdout, ResultOptions{Redaction: policy, Fields: fields})
+		return w, fieldsMask(fields), err
+	}
+}
+
+// redactionFlags добавляет флаги политики скрытия персональных данных: конфиг и переопределения к нему
+func redactionFlags(fs *flag.FlagSet) func() (RedactionPolicy, error) {
+	rawEmail := fs.Bool("raw-email", false, "print emails as is, same as -redact-email keep")
+	config := fs.String("redact-config", "", "JSON file with the redaction policy, flags override it")
+	email := fs.String("redact-email", "", "email: at, keep, mask, hmac or drop")
+	name := fs.String("redact-name", "", "name: keep, pseudonym, initials or drop")
+	phone := fs.String("redact-phone", "", "phone: keep, mask or drop")
+
+	return func() (RedactionPolicy, error) {
+		var policy RedactionPolicy
+		if *config != "" {
+			var err error
+			if policy, err = LoadRedactionPolicy(*config); err != nil {
+				return policy, err
+			}
+		}
+		if *rawEmail {
+			policy.Email = RedactKeep
+		}
+		for _, override := range []struct{ flag, field *string }{{email, &policy.Email}, {name, &policy.Name}, {phone, &policy.Phone}} {
+			if *override.flag != "" {
+				*override.field = *override.flag
+			}
+		}
+		return policy, policy.Validate()
+	}
+}
+
+// maxSkipReport - сколько пропущенных строк перечислять в сводке
+const maxSkipReport = 5
+
+// errorFlags добавляет флаги обработки битых строк. Возвращённая функция создаёт ErrorPolicy
+// и функцию завершения, которая закрывает файл карантина и печатает сводку пропусков в stderr
+func errorFlags(fs *flag.FlagSet) func() (ErrorPolicy, func(), error) {
+	mode := fs.String("on-error", "strict", "malformed lines: strict, skip or quarantine")
+	quarantine := fs.String("quarantine", "", "file for malformed lines in quarantine mode")
+
+	return func() (ErrorPolicy, func(), error) {
+		m, err := ParseErrorMode(*mode)
+		if err != nil {
+			return ErrorPolicy{}, nil, err
+		}
+
+		var skipped []*LineError
+		total := 0
+		policy := ErrorPolicy{Mode: m, OnSkip: func(err *LineError) {
+			if total < maxSkipReport {
+				skipped = append(skipped, err)
+			}
+			total++
+		}}
+
+		var file *os.File
+		if m == ErrorQuarantine {
+			if *quarantine == "" {
+				return ErrorPolicy{}, nil, fmt.Errorf("-quarantine is required with -on-error quarantine")
+			}
+			if file, err = os.Create(*quarantine); err != nil {
+				return ErrorPolicy{}, nil, err
+			}
+			policy.Quarantine = file
+		}
+
+		done := func() {
+			if file != nil {
+				file.Close()
+			}
+			if summary := skippedSummary(skipped, total); summary != "" {
+				fmt.Fprintln(os.Stderr, summary)
+			}
+		}
+		return policy, done, nil
+	}
+}
+
+func runGenerate(args []string) error {
+	opts := DefaultGenerateOptions
+	fs := flag.NewFlagSet("generate", flag.ExitOnError)
+	fs.IntVar(&opts.Lines, "n", opts.Lines, "number of users")
+	fs.Int64Var(&opts.Seed, "seed", opts.Seed, "random seed, the same seed gives the same file")
+	fs.Float64Var(&opts.AndroidShare, "android", opts.AndroidShare, "share of Android browsers")
+	fs.Float64Var(&opts.MSIEShare, "msie", opts.MSIEShare, "share of MSIE browsers")
+	fs.IntVar(&opts.BrowsersPerUser, "browsers", opts.BrowsersPerUser, "max browsers per user")
+	output := fs.String("o", "", "output file, stdout by default")
+	fs.Parse(args)
+
+	if *output == "" {
+		return GenerateUsers(os.Stdout, opts)
+	}
+
+	file, err := os.Create(*output)
+	if err != nil {
+		return err
+	}
+	if err := GenerateUsers(file, opts); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func runGroup(args []string) error {
+	fs := flag.NewFlagSet("group", flag.ExitOnError)
+	by := fs.String("by", "country", "comma-separated fields to group by: user fields, browser, family or os")
+	aggs := fs.String("agg", "count", "aggregations: count, distinct(field), top(field,k), e.g. distinct(browser),top(family,3)")
+	expr := fs.String("q", "", "group only users matching the query")
+	limit := fs.Int("limit", 0, "show only n largest groups, 0 - all")
+	format := fs.String("format", "text", "output format: text, json or csv")
+	maxMemory := fs.Int64("max-memory", DefaultGroupMemory>>20, "MiB of group state kept in memory before spilling to disk")
+	tmp := fs.String("tmp", "", "directory for spill files, system temp dir by default")
+	newPolicy := errorFlags(fs)
+	newRedaction := redactionFlags(fs)
+	fs.Parse(args)
+
+	opts := GroupOptions{Limit: *limit, MaxMemory: *maxMemory << 20, TempDir: *tmp}
+	for _, name := range strings.Split(*by, ",") {
+		opts.By = append(opts.By, strings.TrimSpace(name))
+	}
+	var err error
+	if opts.Aggs, err = ParseAggregations(*aggs); err != nil {
+		return err
+	}
+	if *expr != "" {
+		if opts.Query, err = CompileQuery(*expr); err != nil {
+			return err
+		}
+	}
+	policy, done, err := newPolicy()
+	if err != nil {
+		return err
+	}
+	defer done()
+	opts.Errors = policy
+	if opts.Redaction, err = newRedaction(); err != nil {
+		return err
+	}
+
+	res, err := GroupFile(sourceArg(fs), opts)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "text":
+		return res.WriteText(os.Stdout)
+	case "json":
+		return res.WriteJSON(os.Stdout)
+	case "csv":
+		return res.WriteCSV(os.Stdout)
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+}
+
+func runIndex(args []string) error {
+	fs := flag.NewFlagSet("index", flag.ExitOnError)
+	output := fs.String("o", "", "index file, by default <users_file>.idx")
+	newPolicy := errorFlags(fs)
+	fs.Parse(args)
+
+	source := sourceArg(fs)
+	if *output == "" {
+		*output = IndexPath(source)
+	}
+	policy, done, err := newPolicy()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	idx, err := OpenIndex(source, *output, ScanOptions{Errors: policy})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("indexed %s: %d lines, %d browsers, %d malformed lines\n", source, len(idx.Offsets), len(idx.Browsers), len(idx.Bad))
+	return nil
+}
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "listen address")
+	interval := fs.Duration("interval", time.Second, "how often to check the users file for changes")
+	newPolicy := redactionFlags(fs)
+	fs.Parse(args)
+
+	policy, err := newPolicy()
+	if err != nil {
+		return err
+	}
+	srv, err := NewServer(sourceArg(fs), policy)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	go srv.Watch(ctx, *interval, hup)
+
+	httpServer := &http.Server{Addr: *addr, Handler: srv}
+	shutdown := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		// Shutdown дожидается запросов, которые уже обрабатываются
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		shutdown <- httpServer.Shutdown(shutdownCtx)
+	}()
+
+	ds := srv.Dataset()
+	log.Printf("serving %s (%d users) on %s", ds.Source, len(ds.Users), *addr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return <-shutdown
+}
+
+func runSnapshot(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	output := fs.String("o", "", "snapshot file, by default <users_file>.snap, the only path searches pick up")
+	fs.Parse(args)
+
+	source := sourceArg(fs)
+	if *output == "" {
+		*output = SnapshotPath(source)
+	}
+	return BuildSnapshot(source, *output)
+}
+
+func runSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	expr := fs.String("q", DefaultQueryExpr, "query expression")
+	useIndex := fs.Bool("index", false, "answer from the index, building it if needed")
+	mmap := fs.Bool("mmap", false, "read files through mmap: fewer copies, no line length limit; files must not be truncated while searching")
+	parallel := fs.Int("parallel", 0, "split uncompressed files into chunks and scan them in n goroutines, 0 - one goroutine")
+	approx := fs.Uint("approx", 0, fmt.Sprintf("count unique browsers approximately with 2^p HyperLogLog registers, p in [%d, %d]", MinHLLPrecision, MaxHLLPrecision))
+	showProgress := fs.Bool("progress", false, "print per-file progress to stderr")
+	newWriter := resultFlags(fs)
+	newPolicy := errorFlags(fs)
+	fs.Parse(args)
+
+	q, err := CompileQuery(*expr)
+	if err != nil {
+		return err
+	}
+	w, fields, err := newWriter()
+	if err != nil {
+		return err
+	}
+	policy, done, err := newPolicy()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	if *approx > MaxHLLPrecision {
+		return fmt.Errorf("-approx must be at most %d", MaxHLLPrecision)
+	}
+	if *parallel < 0 {
+		return fmt.Errorf("-parallel must not be negative")
+	}
+	if *parallel > 0 && *mmap {
+		return fmt.Errorf("-parallel and -mmap can't be used together")
+	}
+	opts := ScanOptions{Errors: policy, Precision: uint8(*approx), Fields: fields, Mmap: *mmap, Workers: *parallel}
+
+	if *useIndex {
+		source := sourceArg(fs)
+		idx, err := OpenIndex(source, IndexPath(source), opts)
+		if err != nil {
+			return err
+		}
+		return idx.Search(w, q, opts)
+	}
+
+	paths, err := expandPaths(fs.Args())
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		paths = []string{filePath}
+	}
+	var progress ProgressFunc
+	if *showProgress {
+		progress = func(p Progress) {
+			fmt.Fprintln(os.Stderr, p)
+		}
+	}
+	return SearchFiles(w, paths, q, progress, opts)
+}
+
+func runTail(args []string) error {
+	fs := flag.NewFlagSet("tail", flag.ExitOnError)
+	expr := fs.String("q", DefaultQueryExpr, "query expression")
+	fromEnd := fs.Bool("n", false, "skip existing lines, process only new ones")
+	interval := fs.Duration("interval", 200*time.Millisecond, "poll interval")
+	newWriter := resultFlags(fs)
+	newPolicy := errorFlags(fs)
+	fs.Parse(args)
+
+	q, err := CompileQuery(*expr)
+	if err != nil {
+		return err
+	}
+	w, _, err := newWriter()
+	if err != nil {
+		return err
+	}
+	policy, done, err := newPolicy()
+	if err != nil {
+		return err
+	}
+	defer done()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	return Follow(ctx, w, sourceArg(fs), q, FollowOptions{PollInterval: *interval, FromEnd: *fromEnd, Policy: policy})
+}
+
+func runReport(args []string) error {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	kind := fs.String("kind", ReportFamilies, "report kind: families, os or country-browser")
+	top := fs.Int("top", 10, "show only top n rows, 0 - all")
+	format := fs.String("format", "text", "output format: text or json")
+	expr := fs.String("q", "", "count only users matching the query")
+	fs.Parse(args)
+
+	var q *Query
+	if *expr != "" {
+		var err error
+		if q, err = CompileQuery(*expr); err != nil {
+			return err
+		}
+	}
+
+	file, err := os.Open(sourceArg(fs))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := BuildReport(file, *kind, q, *top)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "text":
+		return report.WriteText(os.Stdout)
+	case "json":
+		return report.WriteJSON(os.Stdout)
+	default:
+		return fmt.Errorf("unknown format %s", *format)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestScanMapped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	lines := writeBrokenUsers(t, path, 1000, []int{7}, "{broken")
+	skip := ScanOptions{Errors: ErrorPolicy{Mode: ErrorSkip}}
+
+	expected, err := scanPath(path, defaultQuery, skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, progress, err := scanMapped(path, defaultQuery, skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.lines != expected.lines || len(got.found) != len(expected.found) || got.seen.Count() != expected.seen.Count() || len(got.bad) != 1 {
+		t.Errorf("got %+v, expected %+v", got.stats(), expected.stats())
+	}
+	for i := range expected.found {
+		if got.found[i].Index != expected.found[i].Index || got.found[i].Email != expected.found[i].Email {
+			t.Errorf("user %d: got %+v, expected %+v", i, got.found[i], expected.found[i])
+		}
+	}
+	// файл уже отображён обратно: ключи seen должны быть копиями, а не ссылками в отображение
+	for browser := range got.seen.(exactBrowsers) {
+		if _, ok := expected.seen.(exactBrowsers)[browser]; !ok {
+			t.Errorf("unexpected browser %q", browser)
+		}
+	}
+	if got.bad[0].err.Offset != expected.bad[0].err.Offset || progress.Lines != 1000 {
+		t.Errorf("bad line at %d, expected %d, progress %+v", got.bad[0].err.Offset, expected.bad[0].err.Offset, progress)
+	}
+
+	// CRLF и перевод строки в конце файла не меняют результат
+	crlf := strings.Join(lines, "\r\n") + "\r\n"
+	if err := os.WriteFile(path, []byte(crlf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err = scanMapped(path, defaultQuery, skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.lines != expected.lines || len(got.found) != len(expected.found) {
+		t.Errorf("crlf: got %+v, expected %+v", got.stats(), expected.stats())
+	}
+}
+
+func TestScanMappedLongLines(t *testing.T) {
+	browsers := make([]string, 5000)
+	for i := range browsers {
+		browsers[i] = `"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36"`
+	}
+	browsers[10] = `"Mozilla/5.0 (Linux; Android 4.4)"`
+	browsers[20] = `"Mozilla/4.0 (compatible; MSIE 8.0)"`
+	long := `{"name":"Long","email":"l@o.ng","browsers":[` + strings.Join(browsers, ",") + `]}`
+	if len(long) < 256<<10 {
+		t.Fatalf("line is too short: %d", len(long))
+	}
+
+	path := filepath.Join(t.TempDir(), "users.txt")
+	if err := os.WriteFile(path, []byte(`{"name":"Short","browsers":["MSIE"]}`+"\n"+long), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := scanPath(path, defaultQuery, ScanOptions{}); err == nil {
+		t.Fatal("bufio.Scanner is expected to fail on a long line")
+	}
+	res, err := scanPath(path, defaultQuery, ScanOptions{Mmap: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.lines != 2 || len(res.found) != 1 || res.found[0].Index != 1 || res.seen.Count() != 3 {
+		t.Errorf("unexpected result %+v %+v", res.stats(), res.found)
+	}
+}
+
+func TestScanMappedGzip(t *testing.T) {
+	path := splitUsersFile(t, t.TempDir(), 1, true)[0]
+	got, progress, err := scanMapped(path, defaultQuery, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := new(bytes.Buffer)
+	FastSearch(expected)
+	out := new(bytes.Buffer)
+	writeAll(NewTextWriter(out), got.found, got.stats())
+	if !progress.Gzip || out.String() != expected.String() {
+		t.Errorf("gzip %v, results:\n%s\nexpected:\n%s", progress.Gzip, out, expected)
+	}
+}
+
+// BenchmarkFastMmap - FastSearch с чтением через mmap, для сравнения с bufio.Scanner в BenchmarkFast
+func BenchmarkFastMmap(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		QuerySearch(NewTextWriter(ioutil.Discard), defaultQuery, ScanOptions{Mmap: true})
+	}
+}
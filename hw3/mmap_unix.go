@@ -0,0 +1,34 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+// +build linux darwin freebsd netbsd openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile отображает файл в память только для чтения. unmap надо вызвать, когда срезы data больше не нужны.
+// Если файл обрезать, пока он отображён, чтение пропавших страниц даёт SIGBUS, MAP_PRIVATE от этого не спасает
+func mapFile(path string) (data []byte, unmap func() error, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	// пустой файл отобразить нельзя, да и незачем
+	if info.Size() == 0 {
+		return nil, func() error { return nil }, nil
+	}
+
+	data, err = syscall.Mmap(int(file.Fd()), 0, int(info.Size()), syscall.PROT_READ, syscall.MAP_SHARED)
+	if err != nil {
+		return nil, nil, &os.PathError{Op: "mmap", Path: path, Err: err}
+	}
+	return data, func() error { return syscall.Munmap(data) }, nil
+}
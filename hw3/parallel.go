@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// chunksPerWorker - на сколько кусков на воркер делится файл, чтобы воркеры не простаивали
+// из-за неравномерной плотности совпадений
+const chunksPerWorker = 4
+
+// ParallelSearch делит файл на куски по границам строк и обрабатывает их на workers горутинах.
+// Вывод совпадает с QuerySearch: индексы считаются от начала файла, порядок строк сохраняется.
+// workers <= 0 - по числу ядер
+func ParallelSearch(w ResultWriter, q *Query, workers int, opts ScanOptions) error {
+	return parallelSearchFile(w, filePath, q, workers, opts)
+}
+
+func parallelSearchFile(w ResultWriter, path string, q *Query, workers int, opts ScanOptions) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	res, err := parallelScan(file, info.Size(), q, workers, opts)
+	if err != nil {
+		return withSource(err, path)
+	}
+	if err := opts.Errors.report(path, res.bad); err != nil {
+		return err
+	}
+	return writeAll(w, res.found, res.stats())
+}
+
+// errChunkStopped - кусок брошен, потому что в одном из предыдущих кусков уже случилась ошибка
+var errChunkStopped = errors.New("chunk stopped")
+
+// stopReader читает кусок chunk, пока ни один из предыдущих кусков не упал
+type stopReader struct {
+	r      io.Reader
+	chunk  int64
+	failed *int64
+}
+
+func (r *stopReader) Read(p []byte) (int, error) {
+	if atomic.LoadInt64(r.failed) < r.chunk {
+		return 0, errChunkStopped
+	}
+	return r.r.Read(p)
+}
+
+// parallelScan - scanUsers по кускам size байт r на workers горутинах.
+// Ошибка в куске останавливает только следующие за ним куски: предыдущие дочитываются,
+// чтобы вернуть ту же первую ошибку, что и последовательный проход
+func parallelScan(r io.ReaderAt, size int64, q *Query, workers int, opts ScanOptions) (scanResult, error) {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	bounds, err := chunkBounds(r, size, workers*chunksPerWorker)
+	if err != nil {
+		return scanResult{}, err
+	}
+
+	results := make([]scanResult, len(bounds)-1)
+	errs := make([]error, len(results))
+	// failed - номер первого упавшего куска, len(results) - пока никто не упал
+	failed := int64(len(results))
+	chunks := make(chan int)
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range chunks {
+				section := &stopReader{r: io.NewSectionReader(r, bounds[i], bounds[i+1]-bounds[i]), chunk: int64(i), failed: &failed}
+				results[i], errs[i] = scanUsers(section, q, opts)
+				if errs[i] == nil || errs[i] == errChunkStopped {
+					continue
+				}
+				for {
+					prev := atomic.LoadInt64(&failed)
+					if prev <= int64(i) || atomic.CompareAndSwapInt64(&failed, prev, int64(i)) {
+						break
+					}
+				}
+			}
+		}()
+	}
+
+	for i := range results {
+		chunks <- i
+	}
+	close(chunks)
+	wg.Wait()
+
+	// номера строк и смещения в ошибках считались от начала куска, переводим их в номера файла.
+	// Куски до первого упавшего дочитаны полностью, поэтому первая ошибка по порядку - настоящая
+	var lines int
+	for i := range results {
+		if errs[i] != nil {
+			if lerr, ok := errs[i].(*LineError); ok {
+				lerr.Line += lines
+				lerr.Offset += bounds[i]
+			}
+			return scanResult{}, errs[i]
+		}
+		for j := range results[i].bad {
+			results[i].bad[j].err.Line += lines
+			results[i].bad[j].err.Offset += bounds[i]
+		}
+		lines += results[i].lines
+	}
+
+	return mergeResults(results), nil
+}
+
+// mergeResults склеивает результаты кусков по порядку, сдвигая индексы на число строк в предыдущих кусках.
+// Счётчик браузеров первого куска используется как общий
+func mergeResults(results []scanResult) scanResult {
+	var merged scanResult
+
+	for _, res := range results {
+		for _, u := range res.found {
+			u.Index += merged.lines
+			merged.found = append(merged.found, u)
+		}
+		if merged.seen == nil {
+			merged.seen = res.seen
+		} else {
+			mergeBrowsers(merged.seen, res.seen)
+		}
+		merged.bad = append(merged.bad, res.bad...)
+		merged.lines += res.lines
+	}
+
+	if merged.seen == nil {
+		merged.seen = make(exactBrowsers)
+	}
+	return merged
+}
+
+// chunkBounds возвращает границы кусков [bounds[i], bounds[i+1]). Каждая граница, кроме 0 и size,
+// стоит сразу после '\n', поэтому строки не разрываются. Пустые куски выбрасываются
+func chunkBounds(r io.ReaderAt, size int64, n int) ([]int64, error) {
+	if n < 1 {
+		n = 1
+	}
+
+	bounds := []int64{0}
+	step := size / int64(n)
+	if step == 0 {
+		step = 1
+	}
+
+	for pos := step; pos < size; pos += step {
+		if pos <= bounds[len(bounds)-1] {
+			continue
+		}
+
+		next, err := nextLineStart(r, pos, size)
+		if err != nil {
+			return nil, err
+		}
+		if next >= size {
+			break
+		}
+		if next > bounds[len(bounds)-1] {
+			bounds = append(bounds, next)
+		}
+		pos = next
+	}
+
+	return append(bounds, size), nil
+}
+
+// nextLineStart ищет начало строки, следующей за позицией pos-1
+func nextLineStart(r io.ReaderAt, pos, size int64) (int64, error) {
+	br := bufio.NewReader(io.NewSectionReader(r, pos-1, size-pos+1))
+	var offset int64
+
+	for {
+		chunk, err := br.ReadSlice('\n')
+		offset += int64(len(chunk))
+		if err == nil {
+			return pos - 1 + offset, nil
+		}
+		if err == io.EOF {
+			return size, nil
+		}
+		if err != bufio.ErrBufferFull {
+			return 0, err
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParallelSearch(t *testing.T) {
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+
+	for _, workers := range []int{1, 3, 8, 64} {
+		parallelOut := new(bytes.Buffer)
+		if err := ParallelSearch(NewTextWriter(parallelOut), defaultQuery, workers, ScanOptions{}); err != nil {
+			t.Fatal(err)
+		}
+
+		if parallelOut.String() != fastOut.String() {
+			t.Errorf("workers %d: results not match\nGot:\n%v\nExpected:\n%v", workers, parallelOut, fastOut)
+		}
+
+		queryOut := new(bytes.Buffer)
+		if err := QuerySearch(NewTextWriter(queryOut), defaultQuery, ScanOptions{Workers: workers}); err != nil {
+			t.Fatal(err)
+		}
+		if queryOut.String() != fastOut.String() {
+			t.Errorf("QuerySearch with %d workers: results not match\nGot:\n%v\nExpected:\n%v", workers, queryOut, fastOut)
+		}
+	}
+}
+
+// countingReaderAt считает прочитанные байты
+type countingReaderAt struct {
+	r io.ReaderAt
+	n int64
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := c.r.ReadAt(p, off)
+	atomic.AddInt64(&c.n, int64(n))
+	return n, err
+}
+
+func TestParallelScanStopsOnError(t *testing.T) {
+	lines := writeBrokenUsers(t, filepath.Join(t.TempDir(), "users.txt"), 1000, []int{10, 900}, "{broken")
+	data := strings.Join(lines, "\n")
+
+	// один воркер берёт куски по порядку: после ошибки в первом куске остальные не читаются
+	r := &countingReaderAt{r: strings.NewReader(data)}
+	_, err := parallelScan(r, int64(len(data)), defaultQuery, 1, ScanOptions{})
+	var lerr *LineError
+	if !errors.As(err, &lerr) || lerr.Line != 11 {
+		t.Fatalf("expected error at line 11, got %v", err)
+	}
+	if r.n > int64(len(data))/2 {
+		t.Errorf("read %d of %d bytes after the first chunk failed", r.n, len(data))
+	}
+
+	// сколько бы воркеров ни было, возвращается первая ошибка файла
+	for _, workers := range []int{2, 8, 64} {
+		_, err := parallelScan(strings.NewReader(data), int64(len(data)), defaultQuery, workers, ScanOptions{})
+		if !errors.As(err, &lerr) || lerr.Line != 11 {
+			t.Errorf("workers %d: expected error at line 11, got %v", workers, err)
+		}
+	}
+}
+
+func TestChunkBounds(t *testing.T) {
+	data := "aa\nbbbb\nc\n\ndddddd\ne"
+	r := strings.NewReader(data)
+
+	for n := 1; n <= len(data)+2; n++ {
+		bounds, err := chunkBounds(r, int64(len(data)), n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var joined string
+		for i := 0; i+1 < len(bounds); i++ {
+			if bounds[i] >= bounds[i+1] {
+				t.Fatalf("n=%d: empty chunk in %v", n, bounds)
+			}
+			if bounds[i] > 0 && data[bounds[i]-1] != '\n' {
+				t.Errorf("n=%d: bound %d is not at line start", n, bounds[i])
+			}
+			joined += data[bounds[i]:bounds[i+1]]
+		}
+		if joined != data {
+			t.Errorf("n=%d: chunks %v lost data", n, bounds)
+		}
+	}
+}
+
+func BenchmarkParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		ParallelSearch(NewTextWriter(ioutil.Discard), defaultQuery, 0, ScanOptions{})
+	}
+}
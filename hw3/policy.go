@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrorMode - что делать со строкой, которая не разбирается как JSON пользователя
+type ErrorMode int
+
+const (
+	// ErrorStrict - остановить поиск и вернуть *LineError
+	ErrorStrict ErrorMode = iota
+	// ErrorSkip - пропустить строку, учесть её в SearchStats.Skipped
+	ErrorSkip
+	// ErrorQuarantine - как ErrorSkip, но ещё и записать строку как есть в ErrorPolicy.Quarantine
+	ErrorQuarantine
+)
+
+var errorModes = map[string]ErrorMode{
+	"strict":     ErrorStrict,
+	"skip":       ErrorSkip,
+	"quarantine": ErrorQuarantine,
+}
+
+func ParseErrorMode(s string) (ErrorMode, error) {
+	mode, ok := errorModes[s]
+	if !ok {
+		return 0, fmt.Errorf("unknown error mode %s", s)
+	}
+	return mode, nil
+}
+
+// ErrorPolicy - нулевое значение строгое, как раньше, только вместо panic возвращается ошибка
+type ErrorPolicy struct {
+	Mode ErrorMode
+	// Quarantine получает плохие строки по одной на строку, в порядке файла
+	Quarantine io.Writer
+	// OnSkip, если задан, вызывается для каждой пропущенной строки в порядке файла
+	OnSkip func(err *LineError)
+}
+
+// LineError - ошибка разбора строки. Line считается с 1, Offset - байтовое смещение начала строки
+type LineError struct {
+	Source string
+	Line   int
+	Offset int64
+	Err    error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("%s:%d (offset %d): %v", e.Source, e.Line, e.Offset, e.Err)
+}
+
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// badLine - пропущенная строка, data сохраняется только для карантина
+type badLine struct {
+	err  LineError
+	data []byte
+}
+
+// lineError в строгом режиме возвращает *LineError, иначе - строку для пропуска.
+// lineNo считается с 1
+func (p ErrorPolicy) lineError(line []byte, lineNo int, offset int64, err error) (badLine, error) {
+	lerr := LineError{Line: lineNo, Offset: offset, Err: err}
+	if p.Mode == ErrorStrict {
+		return badLine{}, &lerr
+	}
+
+	bad := badLine{err: lerr}
+	if p.Mode == ErrorQuarantine {
+		bad.data = append([]byte(nil), line...)
+	}
+	return bad, nil
+}
+
+// report отдаёт пропущенные строки в карантин и OnSkip, проставляя им источник
+func (p ErrorPolicy) report(source string, bad []badLine) error {
+	for i := range bad {
+		if bad[i].err.Source == "" {
+			bad[i].err.Source = source
+		}
+
+		if p.Mode == ErrorQuarantine && p.Quarantine != nil {
+			if _, err := p.Quarantine.Write(append(bad[i].data, '\n')); err != nil {
+				return fmt.Errorf("quarantine: %w", err)
+			}
+		}
+		if p.OnSkip != nil {
+			p.OnSkip(&bad[i].err)
+		}
+	}
+	return nil
+}
+
+// withSource проставляет источник ошибке разбора, остальные ошибки возвращает как есть
+func withSource(err error, source string) error {
+	if lerr, ok := err.(*LineError); ok && lerr.Source == "" {
+		lerr.Source = source
+	}
+	return err
+}
+
+// skippedSummary - краткая сводка о пропущенных строках для stderr
+func skippedSummary(bad []*LineError, total int) string {
+	if total == 0 {
+		return ""
+	}
+
+	lines := []string{fmt.Sprintf("skipped %d malformed lines", total)}
+	for _, err := range bad {
+		lines = append(lines, "  "+err.Error())
+	}
+	if total > len(bad) {
+		lines = append(lines, fmt.Sprintf("  ... and %d more", total-len(bad)))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBrokenUsers пишет первые n строк users.txt, заменяя строки с номерами broken (с 0) на replacement
+func writeBrokenUsers(t *testing.T, path string, n int, broken []int, replacement string) []string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")[:n]
+	for _, i := range broken {
+		lines[i] = replacement
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return lines
+}
+
+func TestErrorPolicyStrict(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	lines := writeBrokenUsers(t, path, 300, []int{120, 250}, `{"browsers": [`)
+	offset := int64(len(strings.Join(lines[:120], "\n")) + 1)
+
+	check := func(name string, err error) {
+		var lerr *LineError
+		if !errors.As(err, &lerr) {
+			t.Fatalf("%s: expected *LineError, got %v", name, err)
+		}
+		if lerr.Source != path || lerr.Line != 121 || lerr.Offset != offset {
+			t.Errorf("%s: wrong error position %v, expected line 121 offset %d", name, lerr, offset)
+		}
+	}
+
+	out := new(bytes.Buffer)
+	check("files", SearchFiles(NewTextWriter(out), []string{path}, defaultQuery, nil, ScanOptions{}))
+	check("parallel", parallelSearchFile(NewTextWriter(out), path, defaultQuery, 4, ScanOptions{}))
+	check("files parallel", SearchFiles(NewTextWriter(out), []string{path}, defaultQuery, nil, ScanOptions{Workers: 4}))
+	if out.Len() != 0 {
+		t.Errorf("nothing should be written on error, got %q", out)
+	}
+}
+
+func TestErrorPolicySkip(t *testing.T) {
+	dir := t.TempDir()
+	broken := []int{0, 120, 250, 299}
+	writeBrokenUsers(t, filepath.Join(dir, "clean.txt"), 300, broken, "{}")
+	path := filepath.Join(dir, "broken.txt")
+	writeBrokenUsers(t, path, 300, broken, "not json")
+
+	// пустой пользователь ни под что не подходит, поэтому результат должен совпасть с пропуском строк
+	expected := new(bytes.Buffer)
+	if err := SearchFiles(NewTextWriter(expected), []string{filepath.Join(dir, "clean.txt")}, defaultQuery, nil, ScanOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	expected.WriteString("Skipped malformed lines 4\n")
+
+	for _, workers := range []int{0, 1, 7} {
+		var skipped []int
+		quarantine := new(bytes.Buffer)
+		policy := ErrorPolicy{Mode: ErrorQuarantine, Quarantine: quarantine, OnSkip: func(err *LineError) {
+			if err.Source != path {
+				t.Errorf("wrong source %s", err.Source)
+			}
+			skipped = append(skipped, err.Line)
+		}}
+
+		out := new(bytes.Buffer)
+		var err error
+		if workers == 0 {
+			err = SearchFiles(NewTextWriter(out), []string{path}, defaultQuery, nil, ScanOptions{Errors: policy})
+		} else {
+			err = parallelSearchFile(NewTextWriter(out), path, defaultQuery, workers, ScanOptions{Errors: policy})
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if out.String() != expected.String() {
+			t.Errorf("workers %d: results not match\nGot:\n%v\nExpected:\n%v", workers, out, expected)
+		}
+		if len(skipped) != 4 || skipped[0] != 1 || skipped[1] != 121 || skipped[2] != 251 || skipped[3] != 300 {
+			t.Errorf("workers %d: wrong skipped lines %v", workers, skipped)
+		}
+		if quarantine.String() != strings.Repeat("not json\n", 4) {
+			t.Errorf("workers %d: wrong quarantine %q", workers, quarantine)
+		}
+	}
+}
+
+func TestSearchReaderLineError(t *testing.T) {
+	err := SearchReader(NewTextWriter(new(bytes.Buffer)), strings.NewReader("{}\n{\n"), defaultQuery, ScanOptions{})
+	var lerr *LineError
+	if !errors.As(err, &lerr) || lerr.Line != 2 || lerr.Offset != 3 || lerr.Source != readerSource {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,388 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query - скомпилированное выражение фильтра, например
+//
+//	browser~"Android" AND browser~"MSIE" AND NOT country="Chile"
+//
+// Поля: browser и все строковые поля User (name, email, country, company, job, phone).
+// Операторы: = (равно), != (не равно), ~ (содержит подстроку), связки AND, OR, NOT и скобки.
+// Для browser условие истинно, если ему удовлетворяет хотя бы один браузер пользователя.
+// Браузеры, подошедшие под любое browser-условие запроса, попадают в счётчик уникальных браузеров
+type Query struct {
+	Expr     string
+	root     queryNode
+	browsers []browserTerm
+	// contains - автомат по подстрокам из browser~ условий, exact - номера условий, проверяемых по одному
+	contains *ahoCorasick
+	exact    []int
+	// fields - поля пользователя, которые читает запрос
+	fields UserFields
+}
+
+const DefaultQueryExpr = `browser~"Android" AND browser~"MSIE"`
+
+var defaultQuery = MustCompileQuery(DefaultQueryExpr)
+
+type queryOp int
+
+const (
+	opEq queryOp = iota
+	opNe
+	opContains
+)
+
+type browserTerm struct {
+	op    queryOp
+	value string
+}
+
+func (t browserTerm) match(browser string) bool {
+	switch t.op {
+	case opEq:
+		return browser == t.value
+	case opNe:
+		return browser != t.value
+	default:
+		return strings.Contains(browser, t.value)
+	}
+}
+
+type queryNode interface {
+	eval(u *User, hits []bool) bool
+}
+
+type andNode struct{ left, right queryNode }
+type orNode struct{ left, right queryNode }
+type notNode struct{ inner queryNode }
+type browserNode struct{ term int }
+type fieldNode struct {
+	get   func(u *User) string
+	op    queryOp
+	value string
+}
+
+func (n andNode) eval(u *User, hits []bool) bool {
+	return n.left.eval(u, hits) && n.right.eval(u, hits)
+}
+func (n orNode) eval(u *User, hits []bool) bool  { return n.left.eval(u, hits) || n.right.eval(u, hits) }
+func (n notNode) eval(u *User, hits []bool) bool { return !n.inner.eval(u, hits) }
+func (n browserNode) eval(u *User, hits []bool) bool {
+	return hits[n.term]
+}
+func (n fieldNode) eval(u *User, hits []bool) bool {
+	v := n.get(u)
+	switch n.op {
+	case opEq:
+		return v == n.value
+	case opNe:
+		return v != n.value
+	default:
+		return strings.Contains(v, n.value)
+	}
+}
+
+var queryFields = map[string]func(u *User) string{
+	"name":    func(u *User) string { return u.Name },
+	"email":   func(u *User) string { return u.Email },
+	"country": func(u *User) string { return u.Country },
+	"company": func(u *User) string { return u.Company },
+	"job":     func(u *User) string { return u.Job },
+	"phone":   func(u *User) string { return u.Phone },
+}
+
+func CompileQuery(expr string) (*Query, error) {
+	tokens, err := lexQuery(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &queryParser{tokens: tokens, q: &Query{Expr: expr}}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("query: unexpected %q at %d", p.tokens[p.pos].text, p.tokens[p.pos].pos)
+	}
+
+	p.q.root = root
+	p.q.compileBrowsers()
+	return p.q, nil
+}
+
+// ahoMinPatterns - с какого числа подстрок автомат быстрее, чем strings.Contains на каждую:
+// Contains использует векторные инструкции, и на паре подстрок автомат проигрывает (BenchmarkManyKeywords*)
+const ahoMinPatterns = 8
+
+// compileBrowsers собирает подстроки browser~ условий в один автомат, если их много,
+// чтобы каждый браузер просматривался один раз независимо от числа условий
+func (q *Query) compileBrowsers() {
+	var patterns []string
+	var ids []int
+	for i, term := range q.browsers {
+		if term.op == opContains {
+			patterns = append(patterns, term.value)
+			ids = append(ids, i)
+		}
+	}
+	if len(patterns) < ahoMinPatterns {
+		patterns, ids = nil, nil
+	}
+
+	for i, term := range q.browsers {
+		if term.op != opContains || patterns == nil {
+			q.exact = append(q.exact, i)
+		}
+	}
+	if patterns != nil {
+		q.contains = newAhoCorasick(patterns, ids)
+	}
+}
+
+// matchBrowser отмечает в hits browser-условия, которым удовлетворяет browser, не сбрасывая остальные.
+// Возвращает true, если browser подошёл хотя бы под одно условие
+func (q *Query) matchBrowser(browser string, hits []bool) bool {
+	matched := false
+	if q.contains != nil {
+		matched = q.contains.match(browser, hits)
+	}
+	for _, i := range q.exact {
+		if q.browsers[i].match(browser) {
+			hits[i] = true
+			matched = true
+		}
+	}
+	return matched
+}
+
+// Fields - поля, без которых запрос не вычислить: их надо разобрать из JSON перед Match
+func (q *Query) Fields() UserFields {
+	return q.fields
+}
+
+func MustCompileQuery(expr string) *Query {
+	q, err := CompileQuery(expr)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+// Matcher проверяет пользователей по запросу. Не потокобезопасен - по одному на горутину
+type Matcher struct {
+	q       *Query
+	hits    []bool
+	matched []string
+}
+
+func (q *Query) NewMatcher() *Matcher {
+	return &Matcher{q: q, hits: make([]bool, len(q.browsers))}
+}
+
+// Match возвращает true, если пользователь подходит под запрос.
+// Если seen не nil, туда добавляются браузеры, подошедшие под browser-условия
+func (m *Matcher) Match(u *User, seen browserCounter) bool {
+	for i := range m.hits {
+		m.hits[i] = false
+	}
+	m.matched = m.matched[:0]
+
+	for _, browser := range u.Browsers {
+		if m.q.matchBrowser(browser, m.hits) {
+			m.matched = append(m.matched, browser)
+			if seen != nil {
+				seen.Add(browser)
+			}
+		}
+	}
+
+	return m.q.root.eval(u, m.hits)
+}
+
+// MatchedBrowsers - браузеры пользователя из последнего вызова Match, подошедшие под browser-условия.
+// Слайс переиспользуется следующим вызовом Match
+func (m *Matcher) MatchedBrowsers() []string {
+	return m.matched
+}
+
+type tokenKind int
+
+const (
+	tokIdent tokenKind = iota
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+func lexQuery(expr string) ([]queryToken, error) {
+	var tokens []queryToken
+
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{tokLParen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{tokRParen, ")", i})
+			i++
+		case c == '=' || c == '~':
+			tokens = append(tokens, queryToken{tokOp, string(c), i})
+			i++
+		case c == '!' && i+1 < len(expr) && expr[i+1] == '=':
+			tokens = append(tokens, queryToken{tokOp, "!=", i})
+			i += 2
+		case c == '"':
+			end := i + 1
+			for ; end < len(expr) && expr[end] != '"'; end++ {
+				if expr[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(expr) {
+				return nil, fmt.Errorf("query: unterminated string at %d", i)
+			}
+			s, err := strconv.Unquote(expr[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("query: bad string at %d: %v", i, err)
+			}
+			tokens = append(tokens, queryToken{tokString, s, i})
+			i = end + 1
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i
+			for end < len(expr) && (expr[end] == '_' || unicode.IsLetter(rune(expr[end])) || unicode.IsDigit(rune(expr[end]))) {
+				end++
+			}
+			tokens = append(tokens, queryToken{tokIdent, expr[i:end], i})
+			i = end
+		default:
+			return nil, fmt.Errorf("query: unexpected %q at %d", c, i)
+		}
+	}
+
+	return tokens, nil
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+	q      *Query
+}
+
+func (p *queryParser) peekKeyword(kw string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokIdent && strings.EqualFold(p.tokens[p.pos].text, kw)
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("OR") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("AND") {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left, right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("query: unexpected end of expression")
+	}
+
+	if p.peekKeyword("NOT") {
+		p.pos++
+		inner, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{inner}, nil
+	}
+
+	if p.tokens[p.pos].kind == tokLParen {
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokRParen {
+			return nil, fmt.Errorf("query: missing )")
+		}
+		p.pos++
+		return inner, nil
+	}
+
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (queryNode, error) {
+	if p.pos+3 > len(p.tokens) {
+		return nil, fmt.Errorf("query: incomplete comparison at %d", p.tokens[p.pos].pos)
+	}
+
+	field, op, value := p.tokens[p.pos], p.tokens[p.pos+1], p.tokens[p.pos+2]
+	if field.kind != tokIdent || op.kind != tokOp || value.kind != tokString {
+		return nil, fmt.Errorf("query: expected field op \"value\" at %d", field.pos)
+	}
+	p.pos += 3
+
+	var qop queryOp
+	switch op.text {
+	case "=":
+		qop = opEq
+	case "!=":
+		qop = opNe
+	default:
+		qop = opContains
+	}
+
+	name := strings.ToLower(field.text)
+	if name == "browser" {
+		p.q.browsers = append(p.q.browsers, browserTerm{qop, value.text})
+		p.q.fields |= UserFieldBrowsers
+		return browserNode{len(p.q.browsers) - 1}, nil
+	}
+
+	get, ok := queryFields[name]
+	if !ok {
+		return nil, fmt.Errorf("query: unknown field %s", field.text)
+	}
+	p.q.fields |= UserFieldsByName[name]
+	return fieldNode{get, qop, value.text}, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestQueryMatch(t *testing.T) {
+	user := &User{
+		Name:     "Sharon Crawford",
+		Country:  "Chile",
+		Browsers: []string{"Mozilla/5.0 (Android; Linux armv7l)", "Mozilla/4.0 (compatible; MSIE 7.0)"},
+	}
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{DefaultQueryExpr, true},
+		{`browser~"Android" AND browser~"MSIE" AND NOT country="Chile"`, false},
+		{`browser~"Opera" OR name~"Sharon"`, true},
+		{`NOT (browser~"Opera" OR country!="Chile")`, true},
+		{`browser="Mozilla/4.0 (compatible; MSIE 7.0)"`, true},
+	}
+
+	for _, c := range cases {
+		q, err := CompileQuery(c.expr)
+		if err != nil {
+			t.Errorf("%s: %v", c.expr, err)
+			continue
+		}
+		if got := q.NewMatcher().Match(user, nil); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestQuerySeenBrowsers(t *testing.T) {
+	user := &User{Browsers: []string{"Android 4", "MSIE 8", "Opera"}}
+	seen := exactBrowsers{}
+
+	defaultQuery.NewMatcher().Match(user, seen)
+	if len(seen) != 2 {
+		t.Errorf("expected 2 seen browsers, got %v", seen)
+	}
+}
+
+func TestQueryErrors(t *testing.T) {
+	for _, expr := range []string{
+		``,
+		`browser~`,
+		`browser~"Android" AND`,
+		`(browser~"Android"`,
+		`salary="100"`,
+		`browser~"unterminated`,
+		`browser # "x"`,
+	} {
+		if _, err := CompileQuery(expr); err == nil {
+			t.Errorf("%q: expected error", expr)
+		}
+	}
+}
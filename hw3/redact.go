@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Режимы скрытия персональных данных в выводе поиска
+const (
+	RedactKeep = "keep" // как есть
+	RedactDrop = "drop" // убрать поле
+	RedactMask = "mask" // email: первая буква логина и ***, телефон: всё, кроме двух последних цифр
+
+	RedactEmailAt   = "at"   // email: @ заменяется на " [at] ", как в исходном FastSearch
+	RedactEmailHMAC = "hmac" // email: HMAC-SHA256 с ключом Key, одинаковый для одного email между запусками
+
+	RedactNamePseudonym = "pseudonym" // имя: "user-" и HMAC имени, одинаковый между запусками с одним ключом
+	RedactNameInitials  = "initials"  // имя: инициалы
+)
+
+// RedactionEnvKey - переменная окружения с ключом HMAC, если он не задан в конфиге,
+// чтобы не хранить ключ рядом с настройками
+const RedactionEnvKey = "HW3_REDACT_KEY"
+
+// RedactionPolicy - как скрывать персональные данные в выводе. Применяется во всех форматах.
+// Пустые режимы - значения по умолчанию: email через " [at] ", имя и телефон как есть
+type RedactionPolicy struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+	Phone string `json:"phone"`
+	Key   string `json:"key,omitempty"`
+}
+
+var redactionModes = map[string][]string{
+	"email": {RedactEmailAt, RedactKeep, RedactMask, RedactEmailHMAC, RedactDrop},
+	"name":  {RedactKeep, RedactNamePseudonym, RedactNameInitials, RedactDrop},
+	"phone": {RedactKeep, RedactMask, RedactDrop},
+}
+
+// LoadRedactionPolicy читает политику из JSON-файла вида {"email": "hmac", "name": "pseudonym", "phone": "drop"}.
+// Неизвестный ключ - ошибка: опечатка в имени поля иначе молча оставила бы данные открытыми
+func LoadRedactionPolicy(path string) (RedactionPolicy, error) {
+	var p RedactionPolicy
+	file, err := os.Open(path)
+	if err != nil {
+		return p, err
+	}
+	defer file.Close()
+
+	dec := json.NewDecoder(file)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return RedactionPolicy{}, fmt.Errorf("redaction config %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func (p RedactionPolicy) withDefaults() RedactionPolicy {
+	if p.Email == "" {
+		p.Email = RedactEmailAt
+	}
+	if p.Name == "" {
+		p.Name = RedactKeep
+	}
+	if p.Phone == "" {
+		p.Phone = RedactKeep
+	}
+	if p.Key == "" {
+		p.Key = os.Getenv(RedactionEnvKey)
+	}
+	return p
+}
+
+func (p RedactionPolicy) Validate() error {
+	p = p.withDefaults()
+	for field, mode := range map[string]string{"email": p.Email, "name": p.Name, "phone": p.Phone} {
+		if !containsString(redactionModes[field], mode) {
+			return fmt.Errorf("redaction: unknown %s mode %s, expected one of %s", field, mode, strings.Join(redactionModes[field], ", "))
+		}
+	}
+	if (p.Email == RedactEmailHMAC || p.Name == RedactNamePseudonym) && p.Key == "" {
+		return fmt.Errorf("redaction: %s and %s need a key, set it in the config or %s", RedactEmailHMAC, RedactNamePseudonym, RedactionEnvKey)
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// redactor применяет проверенную политику к найденным пользователям
+type redactor struct {
+	p RedactionPolicy
+}
+
+func newRedactor(p RedactionPolicy) (*redactor, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	return &redactor{p.withDefaults()}, nil
+}
+
+func (r *redactor) hmac(domain, value string) string {
+	mac := hmac.New(sha256.New, []byte(r.p.Key))
+	// домен разделяет email и имена, чтобы одинаковые строки не давали одинаковый хеш
+	mac.Write([]byte(domain))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (r *redactor) email(email string) string {
+	switch r.p.Email {
+	case RedactKeep:
+		return email
+	case RedactDrop:
+		return ""
+	case RedactEmailHMAC:
+		return r.hmac("email", email)[:32]
+	case RedactMask:
+		at := strings.IndexByte(email, '@')
+		if at <= 0 {
+			return "***"
+		}
+		return email[:1] + "***" + email[at:]
+	default:
+		return strings.Replace(email, "@", " [at] ", 1)
+	}
+}
+
+func (r *redactor) name(name string) string {
+	switch r.p.Name {
+	case RedactDrop:
+		return ""
+	case RedactNamePseudonym:
+		return "user-" + r.hmac("name", name)[:12]
+	case RedactNameInitials:
+		var initials []string
+		for _, part := range strings.Fields(name) {
+			initials = append(initials, string([]rune(part)[:1])+".")
+		}
+		return strings.Join(initials, " ")
+	default:
+		return name
+	}
+}
+
+func (r *redactor) phone(phone string) string {
+	switch r.p.Phone {
+	case RedactDrop:
+		return ""
+	case RedactMask:
+		masked := []byte(phone)
+		digits := 0
+		for i := len(masked) - 1; i >= 0; i-- {
+			if masked[i] >= '0' && masked[i] <= '9' {
+				if digits >= 2 {
+					masked[i] = '*'
+				}
+				digits++
+			}
+		}
+		return string(masked)
+	default:
+		return phone
+	}
+}
+
+// field скрывает значение поля пользователя по имени, остальные поля возвращает как есть
+func (r *redactor) field(name, value string) string {
+	switch name {
+	case "email":
+		return r.email(value)
+	case "name":
+		return r.name(value)
+	case "phone":
+		return r.phone(value)
+	default:
+		return value
+	}
+}
+
+func (r *redactor) user(u FoundUser) FoundUser {
+	u.Name = r.name(u.Name)
+	u.Email = r.email(u.Email)
+	u.Phone = r.phone(u.Phone)
+	return u
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r, err := newRedactor(RedactionPolicy{Email: RedactMask, Name: RedactNameInitials, Phone: RedactMask})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := r.email("JonathanMorris@Muxo.edu"); got != "J***@Muxo.edu" {
+		t.Errorf("masked email %q", got)
+	}
+	if got := r.name("Sharon Crawford"); got != "S. C." {
+		t.Errorf("initials %q", got)
+	}
+	if got := r.phone("176-88-49"); got != "***-**-49" {
+		t.Errorf("masked phone %q", got)
+	}
+
+	keyed := RedactionPolicy{Email: RedactEmailHMAC, Name: RedactNamePseudonym, Key: "secret"}
+	first, _ := newRedactor(keyed)
+	second, _ := newRedactor(keyed)
+	keyed.Key = "other"
+	other, _ := newRedactor(keyed)
+
+	u := FoundUser{Name: "Sharon Crawford", Email: "a@b.c"}
+	a, b, c := first.user(u), second.user(u), other.user(u)
+	if a.Name != b.Name || a.Email != b.Email {
+		t.Errorf("same key should give the same pseudonyms: %+v %+v", a, b)
+	}
+	if a.Name == c.Name || a.Email == c.Email || strings.Contains(a.Email, "@") || !strings.HasPrefix(a.Name, "user-") {
+		t.Errorf("bad keyed redaction %+v, other key %+v", a, c)
+	}
+}
+
+func TestRedactionPolicyValidate(t *testing.T) {
+	os.Unsetenv(RedactionEnvKey)
+	for _, p := range []RedactionPolicy{
+		{Email: "rot13"},
+		{Phone: RedactNamePseudonym},
+		{Email: RedactEmailHMAC},
+		{Name: RedactNamePseudonym},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("expected error for %+v", p)
+		}
+	}
+
+	os.Setenv(RedactionEnvKey, "secret")
+	defer os.Unsetenv(RedactionEnvKey)
+	if err := (RedactionPolicy{Email: RedactEmailHMAC}).Validate(); err != nil {
+		t.Errorf("key from environment is not used: %v", err)
+	}
+}
+
+func TestLoadRedactionPolicy(t *testing.T) {
+	dir := t.TempDir()
+	good := filepath.Join(dir, "good.json")
+	os.WriteFile(good, []byte(`{"email": "mask", "phone": "drop"}`), 0644)
+	p, err := LoadRedactionPolicy(good)
+	if err != nil || p.Email != RedactMask || p.Phone != RedactDrop {
+		t.Errorf("got %+v, %v", p, err)
+	}
+
+	// опечатка в ключе не должна молча оставлять данные открытыми
+	typo := filepath.Join(dir, "typo.json")
+	os.WriteFile(typo, []byte(`{"emial": "drop"}`), 0644)
+	if _, err := LoadRedactionPolicy(typo); err == nil || !strings.Contains(err.Error(), "emial") {
+		t.Errorf("expected unknown field error, got %v", err)
+	}
+}
+
+// политика должна действовать во всех форматах
+func TestRedactionAllFormats(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redact.json")
+	os.WriteFile(path, []byte(`{"email": "drop", "name": "pseudonym", "key": "k"}`), 0644)
+	policy, err := LoadRedactionPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{FormatText, FormatJSON, FormatNDJSON, FormatCSV} {
+		got := renderResults(t, format, ResultOptions{Redaction: policy})
+		for _, pii := range []string{"Sharon", "Crawford", "a@b.c", "a [at] b.c", "x@y.z", "Doe"} {
+			if strings.Contains(got, pii) {
+				t.Errorf("%s output leaks %q:\n%s", format, pii, got)
+			}
+		}
+		if !strings.Contains(got, "user-") {
+			t.Errorf("%s output has no pseudonyms:\n%s", format, got)
+		}
+	}
+
+	var decoded struct{ Users []map[string]interface{} }
+	json.Unmarshal([]byte(renderResults(t, FormatJSON, ResultOptions{Redaction: policy})), &decoded)
+	if _, ok := decoded.Users[0]["email"]; ok {
+		t.Errorf("dropped email is still in json: %v", decoded.Users[0])
+	}
+
+	if _, err := NewResultWriter(FormatText, new(bytes.Buffer), ResultOptions{Redaction: RedactionPolicy{Name: "hide"}}); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	ReportFamilies       = "families"
+	ReportOS             = "os"
+	ReportCountryBrowser = "country-browser"
+)
+
+// Report - таблица "ключи -> число пользователей", отсортированная по убыванию.
+// Пользователь учитывается в строке один раз, даже если у него несколько подходящих браузеров
+type Report struct {
+	Kind    string      `json:"kind"`
+	Columns []string    `json:"columns"`
+	Rows    []ReportRow `json:"rows"`
+	Users   int         `json:"users"`
+}
+
+type ReportRow struct {
+	Keys  []string `json:"keys"`
+	Users int      `json:"users"`
+}
+
+var reportColumns = map[string][]string{
+	ReportFamilies:       {"family"},
+	ReportOS:             {"os"},
+	ReportCountryBrowser: {"country", "family"},
+}
+
+// BuildReport считает отчёт kind по пользователям из r. Если q не nil, учитываются
+// только подходящие под запрос пользователи. top > 0 оставляет только первые top строк
+func BuildReport(r io.Reader, kind string, q *Query, top int) (*Report, error) {
+	columns, ok := reportColumns[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown report %s", kind)
+	}
+
+	src, _, err := openSource(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var matcher *Matcher
+	if q != nil {
+		matcher = q.NewMatcher()
+	}
+
+	report := &Report{Kind: kind, Columns: columns}
+	counts := make(map[string]int)
+	parsed := make(map[string]UserAgent)
+	userKeys := make(map[string]struct{})
+	scanner := bufio.NewScanner(src)
+	var user User
+
+	for line := 1; scanner.Scan(); line++ {
+		if err := user.DecodeJSON(scanner.Bytes()); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if matcher != nil && !matcher.Match(&user, nil) {
+			continue
+		}
+		report.Users++
+
+		for key := range userKeys {
+			delete(userKeys, key)
+		}
+		for _, browser := range user.Browsers {
+			ua, ok := parsed[browser]
+			if !ok {
+				ua = ParseUserAgent(browser)
+				parsed[browser] = ua
+			}
+
+			switch kind {
+			case ReportFamilies:
+				userKeys[ua.Family] = struct{}{}
+			case ReportOS:
+				userKeys[ua.OS] = struct{}{}
+			case ReportCountryBrowser:
+				userKeys[user.Country+"\x00"+ua.Family] = struct{}{}
+			}
+		}
+		for key := range userKeys {
+			counts[key]++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for key, n := range counts {
+		report.Rows = append(report.Rows, ReportRow{Keys: strings.Split(key, "\x00"), Users: n})
+	}
+	sort.Slice(report.Rows, func(i, j int) bool {
+		a, b := report.Rows[i], report.Rows[j]
+		if a.Users != b.Users {
+			return a.Users > b.Users
+		}
+		return strings.Join(a.Keys, "\x00") < strings.Join(b.Keys, "\x00")
+	})
+	if top > 0 && len(report.Rows) > top {
+		report.Rows = report.Rows[:top]
+	}
+
+	return report, nil
+}
+
+func (r *Report) WriteText(out io.Writer) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(r.Columns, "\t")+"\tusers")
+	for _, row := range r.Rows {
+		fmt.Fprintf(w, "%s\t%d\n", strings.Join(row.Keys, "\t"), row.Users)
+	}
+	fmt.Fprintf(w, "total users\t%d\n", r.Users)
+	return w.Flush()
+}
+
+func (r *Report) WriteJSON(out io.Writer) error {
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
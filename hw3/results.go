@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// FoundUser - найденный пользователь. Browsers - браузеры, подошедшие под browser-условия запроса.
+// Поля, не выбранные в выводе (см. ResultOptions.Fields), пустые
+type FoundUser struct {
+	Index    int      `json:"index"`
+	Name     string   `json:"name,omitempty"`
+	Email    string   `json:"email,omitempty"`
+	Country  string   `json:"country,omitempty"`
+	Company  string   `json:"company,omitempty"`
+	Job      string   `json:"job,omitempty"`
+	Phone    string   `json:"phone,omitempty"`
+	Browsers []string `json:"browsers,omitempty"`
+}
+
+type SearchStats struct {
+	Lines          int `json:"lines"`
+	Matched        int `json:"matched"`
+	UniqueBrowsers int `json:"unique_browsers"`
+	// StdError - относительная стандартная ошибка UniqueBrowsers при приблизительном подсчёте, 0 - точное значение
+	StdError float64 `json:"unique_browsers_std_error,omitempty"`
+	Skipped  int     `json:"skipped,omitempty"` // пропущенные битые строки, см. ErrorPolicy
+}
+
+// uniqueBrowsers - число уникальных браузеров для текстовых форматов, с ошибкой, если оно приблизительное
+func (s SearchStats) uniqueBrowsers() string {
+	if s.StdError == 0 {
+		return strconv.Itoa(s.UniqueBrowsers)
+	}
+	return fmt.Sprintf("~%d (std error %.1f%%)", s.UniqueBrowsers, s.StdError*100)
+}
+
+// ResultWriter выводит результаты поиска в каком-то формате.
+// WriteUser вызывается для найденных пользователей по порядку, Close - один раз в конце
+type ResultWriter interface {
+	WriteUser(u FoundUser) error
+	Flush() error
+	Close(stats SearchStats) error
+}
+
+// StatsWriter - ResultWriter, умеющий выводить промежуточную статистику (нужно для tail)
+type StatsWriter interface {
+	WriteStats(stats SearchStats) error
+}
+
+const (
+	FormatText   = "text"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+	FormatCSV    = "csv"
+)
+
+type ResultOptions struct {
+	// Redaction - как скрывать персональные данные, по умолчанию email через " [at] "
+	Redaction RedactionPolicy
+	// Fields - какие поля выводить и в каком порядке, по умолчанию DefaultFields в исходном формате
+	Fields []UserFields
+}
+
+// userView готовит найденного пользователя к выводу: оставляет выбранные поля и скрывает персональные данные
+type userView struct {
+	r      *redactor
+	fields []UserFields
+	mask   UserFields
+}
+
+func (v *userView) user(u FoundUser) FoundUser {
+	return v.r.user(u.project(v.mask))
+}
+
+// columns - выводимые поля по порядку, для табличных форматов
+func (v *userView) columns() []UserFields {
+	if len(v.fields) == 0 {
+		return DefaultFields
+	}
+	return v.fields
+}
+
+func NewResultWriter(format string, out io.Writer, opts ResultOptions) (ResultWriter, error) {
+	r, err := newRedactor(opts.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	v := &userView{r: r, fields: opts.Fields, mask: fieldsMask(opts.Fields)}
+
+	w := bufio.NewWriter(out)
+	switch format {
+	case FormatText, "":
+		return &textWriter{w: w, v: v}, nil
+	case FormatJSON:
+		return &jsonWriter{w: w, v: v}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{w: w, v: v}, nil
+	case FormatCSV:
+		return &csvWriter{w: w, csv: csv.NewWriter(w), v: v}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+}
+
+// NewTextWriter - исходный формат FastSearch: "found users:", строки [i] name <email> и число уникальных браузеров
+func NewTextWriter(out io.Writer) ResultWriter {
+	w, _ := NewResultWriter(FormatText, out, ResultOptions{})
+	return w
+}
+
+func writeAll(w ResultWriter, found []FoundUser, stats SearchStats) error {
+	for _, u := range found {
+		if err := w.WriteUser(u); err != nil {
+			return err
+		}
+	}
+	return w.Close(stats)
+}
+
+type textWriter struct {
+	w         *bufio.Writer
+	v         *userView
+	hasHeader bool
+}
+
+func (t *textWriter) header() {
+	if !t.hasHeader {
+		t.w.WriteString("found users:\n")
+		t.hasHeader = true
+	}
+}
+
+func (t *textWriter) WriteUser(u FoundUser) error {
+	t.header()
+	u = t.v.user(u)
+
+	// с выбранными полями - значения через " | " в заданном порядке
+	fmt.Fprintf(t.w, "[%d]", u.Index)
+	if len(t.v.fields) > 0 {
+		for i, f := range t.v.fields {
+			if i > 0 {
+				t.w.WriteString(" |")
+			}
+			fmt.Fprintf(t.w, " %s", u.fieldValue(f))
+		}
+		return t.w.WriteByte('\n')
+	}
+
+	// убранные политикой поля не печатаются вовсе
+	if u.Name != "" {
+		fmt.Fprintf(t.w, " %s", u.Name)
+	}
+	if u.Email != "" {
+		fmt.Fprintf(t.w, " <%s>", u.Email)
+	}
+	return t.w.WriteByte('\n')
+}
+
+func (t *textWriter) WriteStats(stats SearchStats) error {
+	fmt.Fprintln(t.w, "Total unique browsers", stats.uniqueBrowsers())
+	if stats.Skipped > 0 {
+		fmt.Fprintln(t.w, "Skipped malformed lines", stats.Skipped)
+	}
+	return t.w.Flush()
+}
+
+func (t *textWriter) Flush() error {
+	return t.w.Flush()
+}
+
+func (t *textWriter) Close(stats SearchStats) error {
+	t.header()
+	t.w.WriteString("\n")
+	return t.WriteStats(stats)
+}
+
+type jsonWriter struct {
+	w     *bufio.Writer
+	v     *userView
+	count int
+}
+
+func (j *jsonWriter) WriteUser(u FoundUser) error {
+	if j.count == 0 {
+		j.w.WriteString(`{"users":[`)
+	} else {
+		j.w.WriteString(",")
+	}
+	j.count++
+
+	u = j.v.user(u)
+	data, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *jsonWriter) Flush() error {
+	return j.w.Flush()
+}
+
+func (j *jsonWriter) Close(stats SearchStats) error {
+	if j.count == 0 {
+		j.w.WriteString(`{"users":[`)
+	}
+
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(j.w, `],"stats":%s}`+"\n", data)
+	return j.w.Flush()
+}
+
+type ndjsonWriter struct {
+	w *bufio.Writer
+	v *userView
+}
+
+type ndjsonUser struct {
+	Type string `json:"type"`
+	FoundUser
+}
+
+type ndjsonStats struct {
+	Type string `json:"type"`
+	SearchStats
+}
+
+func (n *ndjsonWriter) writeLine(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	n.w.Write(data)
+	return n.w.WriteByte('\n')
+}
+
+func (n *ndjsonWriter) WriteUser(u FoundUser) error {
+	u = n.v.user(u)
+	return n.writeLine(ndjsonUser{"user", u})
+}
+
+func (n *ndjsonWriter) WriteStats(stats SearchStats) error {
+	if err := n.writeLine(ndjsonStats{"stats", stats}); err != nil {
+		return err
+	}
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+func (n *ndjsonWriter) Close(stats SearchStats) error {
+	return n.WriteStats(stats)
+}
+
+// csvWriter пишет строку заголовка (index и выбранные поля) и по строке на пользователя, браузеры разделены "|".
+// Статистика идёт последней строкой-комментарием "# lines=..." (csv.Reader с Comment = '#' её пропустит)
+type csvWriter struct {
+	w         *bufio.Writer
+	csv       *csv.Writer
+	v         *userView
+	hasHeader bool
+}
+
+func (c *csvWriter) header() error {
+	if c.hasHeader {
+		return nil
+	}
+	c.hasHeader = true
+	row := []string{"index"}
+	for _, f := range c.v.columns() {
+		row = append(row, fieldName(f))
+	}
+	return c.csv.Write(row)
+}
+
+func (c *csvWriter) WriteUser(u FoundUser) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	u = c.v.user(u)
+	row := []string{strconv.Itoa(u.Index)}
+	for _, f := range c.v.columns() {
+		row = append(row, u.fieldValue(f))
+	}
+	return c.csv.Write(row)
+}
+
+func (c *csvWriter) Flush() error {
+	c.csv.Flush()
+	if err := c.csv.Error(); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *csvWriter) Close(stats SearchStats) error {
+	if err := c.header(); err != nil {
+		return err
+	}
+	c.csv.Flush()
+	fmt.Fprintf(c.w, "# lines=%d matched=%d unique_browsers=%d unique_browsers_std_error=%g skipped=%d\n",
+		stats.Lines, stats.Matched, stats.UniqueBrowsers, stats.StdError, stats.Skipped)
+	return c.Flush()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+var resultsFixture = []FoundUser{
+	{Index: 3, Name: "Sharon Crawford", Email: "a@b.c", Browsers: []string{"Android 4", "MSIE 9"}},
+	{Index: 7, Name: "Doe, John", Email: "x@y.z", Browsers: []string{"MSIE 8"}},
+}
+
+var statsFixture = SearchStats{Lines: 10, Matched: 2, UniqueBrowsers: 3}
+
+func renderResults(t *testing.T, format string, opts ResultOptions) string {
+	out := new(bytes.Buffer)
+	w, err := NewResultWriter(format, out, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeAll(w, resultsFixture, statsFixture); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestTextWriter(t *testing.T) {
+	expected := "found users:\n[3] Sharon Crawford <a [at] b.c>\n[7] Doe, John <x [at] y.z>\n\nTotal unique browsers 3\n"
+	if got := renderResults(t, FormatText, ResultOptions{}); got != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestJSONWriter(t *testing.T) {
+	var decoded struct {
+		Users []FoundUser
+		Stats SearchStats
+	}
+	if err := json.Unmarshal([]byte(renderResults(t, FormatJSON, ResultOptions{Redaction: RedactionPolicy{Email: RedactKeep}})), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Users) != 2 || decoded.Users[0].Email != "a@b.c" || decoded.Stats != statsFixture {
+		t.Errorf("unexpected json result %+v", decoded)
+	}
+
+	var empty struct{ Users []FoundUser }
+	out := new(bytes.Buffer)
+	w, _ := NewResultWriter(FormatJSON, out, ResultOptions{})
+	w.Close(SearchStats{})
+	if err := json.Unmarshal(out.Bytes(), &empty); err != nil {
+		t.Errorf("bad empty json %s: %v", out, err)
+	}
+}
+
+func TestNDJSONWriter(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(renderResults(t, FormatNDJSON, ResultOptions{})), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d", len(lines))
+	}
+
+	var user struct {
+		Type string
+		FoundUser
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &user); err != nil || user.Type != "user" || user.Email != "x [at] y.z" {
+		t.Errorf("bad user line %s: %v", lines[1], err)
+	}
+	if !strings.Contains(lines[2], `"type":"stats"`) {
+		t.Errorf("bad stats line %s", lines[2])
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	r := csv.NewReader(strings.NewReader(renderResults(t, FormatCSV, ResultOptions{})))
+	r.Comment = '#'
+	records, err := r.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 || records[2][1] != "Doe, John" || records[1][3] != "Android 4|MSIE 9" {
+		t.Errorf("unexpected csv records %q", records)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 1000
+)
+
+// Dataset - файл пользователей, целиком разобранный в память. После загрузки не меняется,
+// поэтому запросы читают его без блокировок. Lines[i] - номер строки файла для Users[i]
+type Dataset struct {
+	Source   string
+	Users    []User
+	Lines    []int
+	Skipped  int
+	LoadedAt time.Time
+
+	size    int64
+	modTime time.Time
+}
+
+// LoadDataset читает source (в том числе gzip). Битые строки пропускаются и считаются в Skipped,
+// чтобы одна испорченная запись не останавливала сервис
+func LoadDataset(source string) (*Dataset, error) {
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	src, _, err := openSource(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ds := &Dataset{Source: source, LoadedAt: time.Now(), size: info.Size(), modTime: info.ModTime()}
+	scanner := bufio.NewScanner(src)
+	for line := 0; scanner.Scan(); line++ {
+		var user User
+		if err := user.DecodeJSON(scanner.Bytes()); err != nil {
+			ds.Skipped++
+			continue
+		}
+		ds.Users = append(ds.Users, user)
+		ds.Lines = append(ds.Lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return ds, nil
+}
+
+// Server - HTTP-сервис поиска по датасету в памяти:
+//
+//	GET /users?browser=Android&browser=MSIE&country=Kenya&fields=name,phone&offset=0&limit=50
+//	GET /stats/browsers?browser=MSIE
+//
+// Фильтры: browser и name, email, job, phone - подстрока, country и company - точное совпадение, q - выражение запроса
+// как у поиска (см. Query), все условия объединяются через AND. fields - поля пользователей в ответе, как -fields у поиска. Ответы в формате {"error": "", "response": ...}.
+// Датасет заменяется целиком при Reload, запросы, начатые до замены, дорабатывают со старым
+type Server struct {
+	source string
+	data   atomic.Value // *Dataset
+	r      *redactor
+	mux    *http.ServeMux
+	reload sync.Mutex
+}
+
+func NewServer(source string, redaction RedactionPolicy) (*Server, error) {
+	r, err := newRedactor(redaction)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{source: source, r: r, mux: http.NewServeMux()}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	s.mux.HandleFunc("/users", s.handleUsers)
+	s.mux.HandleFunc("/stats/browsers", s.handleBrowserStats)
+	return s, nil
+}
+
+func (s *Server) Dataset() *Dataset {
+	return s.data.Load().(*Dataset)
+}
+
+// Reload перечитывает файл. При ошибке остаётся прежний датасет
+func (s *Server) Reload() error {
+	s.reload.Lock()
+	defer s.reload.Unlock()
+
+	ds, err := LoadDataset(s.source)
+	if err != nil {
+		return err
+	}
+	s.data.Store(ds)
+	return nil
+}
+
+// changed - файл изменился с момента последней загрузки
+func (s *Server) changed() bool {
+	info, err := os.Stat(s.source)
+	if err != nil {
+		return false
+	}
+	ds := s.Dataset()
+	return info.Size() != ds.size || !info.ModTime().Equal(ds.modTime)
+}
+
+// Watch перезагружает датасет при изменении файла и при получении значения из reload (SIGHUP).
+// Работает до отмены ctx
+func (s *Server) Watch(ctx context.Context, interval time.Duration, reload <-chan os.Signal) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+		case <-ticker.C:
+			if !s.changed() {
+				continue
+			}
+		}
+
+		if err := s.Reload(); err != nil {
+			log.Printf("reload %s: %v", s.source, err)
+			continue
+		}
+		ds := s.Dataset()
+		log.Printf("loaded %s: %d users, %d skipped lines", ds.Source, len(ds.Users), ds.Skipped)
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// filterQuery собирает запрос из параметров, nil - без фильтров
+func filterQuery(r *http.Request) (*Query, error) {
+	params := r.URL.Query()
+	var conds []string
+
+	for _, f := range []struct{ param, cond string }{
+		{"browser", "browser~"},
+		{"name", "name~"},
+		{"email", "email~"},
+		{"country", "country="},
+		{"company", "company="},
+		{"job", "job~"},
+		{"phone", "phone~"},
+	} {
+		for _, value := range params[f.param] {
+			conds = append(conds, f.cond+strconv.Quote(value))
+		}
+	}
+	for _, expr := range params["q"] {
+		conds = append(conds, "("+expr+")")
+	}
+
+	if len(conds) == 0 {
+		return nil, nil
+	}
+	return CompileQuery(strings.Join(conds, " AND "))
+}
+
+func intParam(r *http.Request, name string, def, max int) (int, error) {
+	raw := r.URL.Query().Get(name)
+	if raw == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", name)
+	}
+	if max > 0 && n > max {
+		n = max
+	}
+	return n, nil
+}
+
+type usersPage struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Users  []FoundUser `json:"users"`
+}
+
+type browserStats struct {
+	Lines          int `json:"lines"`
+	Matched        int `json:"matched"`
+	UniqueBrowsers int `json:"unique_browsers"`
+}
+
+// scan вызывает found для каждого подходящего пользователя. Без фильтров подходят все
+func (ds *Dataset) scan(q *Query, seen browserCounter, found func(i int, m *Matcher)) {
+	var m *Matcher
+	if q != nil {
+		m = q.NewMatcher()
+	}
+
+	for i := range ds.Users {
+		if m != nil && !m.Match(&ds.Users[i], seen) {
+			continue
+		}
+		found(i, m)
+	}
+}
+
+func (s *Server) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	q, err := filterQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, err := intParam(r, "offset", 0, 0)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit, err := intParam(r, "limit", defaultPageLimit, maxPageLimit)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fields, err := ParseFields(r.URL.Query().Get("fields"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	mask := fieldsMask(fields)
+
+	ds := s.Dataset()
+	page := usersPage{Offset: offset, Limit: limit, Users: []FoundUser{}}
+	ds.scan(q, nil, func(i int, m *Matcher) {
+		if page.Total >= offset && len(page.Users) < limit {
+			u := &ds.Users[i]
+			found := FoundUser{Index: ds.Lines[i], Name: u.Name, Email: u.Email, Country: u.Country,
+				Company: u.Company, Job: u.Job, Phone: u.Phone, Browsers: u.Browsers}
+			if m != nil {
+				found.Browsers = append([]string(nil), m.MatchedBrowsers()...)
+			}
+			page.Users = append(page.Users, s.r.user(found.project(mask)))
+		}
+		page.Total++
+	})
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// handleBrowserStats считает уникальные браузеры подошедших пользователей: как в поиске, браузеры,
+// подошедшие под browser-условия, а если их нет - все браузеры пользователей
+func (s *Server) handleBrowserStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	q, err := filterQuery(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	ds := s.Dataset()
+	seen := make(exactBrowsers)
+	byTerms := q != nil && len(q.browsers) > 0
+	stats := browserStats{Lines: len(ds.Users) + ds.Skipped}
+
+	ds.scan(q, seen, func(i int, m *Matcher) {
+		stats.Matched++
+		if !byTerms {
+			for _, browser := range ds.Users[i].Browsers {
+				seen.Add(browser)
+			}
+		}
+	})
+	stats.UniqueBrowsers = seen.Count()
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": msg})
+}
+
+func writeJSON(w http.ResponseWriter, status int, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": "", "response": response})
+}
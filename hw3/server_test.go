@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type usersResponse struct {
+	Error    string
+	Response usersPage
+}
+
+func getJSON(t *testing.T, ts *httptest.Server, path string, params url.Values, v interface{}) int {
+	resp, err := http.Get(ts.URL + path + "?" + params.Encode())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func newTestServer(t *testing.T, lines int) (*Server, *httptest.Server, string) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	writeBrokenUsers(t, path, lines, []int{3}, "{broken")
+
+	srv, err := NewServer(path, RedactionPolicy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	return srv, ts, path
+}
+
+func TestServerUsers(t *testing.T) {
+	srv, ts, path := newTestServer(t, 1000)
+	if ds := srv.Dataset(); len(ds.Users) != 999 || ds.Skipped != 1 {
+		t.Fatalf("expected 999 users and 1 skipped line, got %d and %d", len(ds.Users), ds.Skipped)
+	}
+
+	scanned, err := scanPath(path, defaultQuery, ScanOptions{Errors: ErrorPolicy{Mode: ErrorSkip}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// постранично выбираем всех пользователей Android + MSIE и сравниваем с обычным поиском
+	var got []FoundUser
+	for offset := 0; ; offset += 10 {
+		var body usersResponse
+		params := url.Values{"browser": {"Android", "MSIE"}, "offset": {strconv.Itoa(offset)}, "limit": {"10"}}
+		if code := getJSON(t, ts, "/users", params, &body); code != http.StatusOK {
+			t.Fatalf("status %d: %s", code, body.Error)
+		}
+		if body.Response.Total != len(scanned.found) {
+			t.Fatalf("total %d, expected %d", body.Response.Total, len(scanned.found))
+		}
+		if len(body.Response.Users) == 0 {
+			break
+		}
+		got = append(got, body.Response.Users...)
+	}
+
+	if len(got) != len(scanned.found) {
+		t.Fatalf("got %d users, expected %d", len(got), len(scanned.found))
+	}
+	for i, u := range got {
+		expected := scanned.found[i]
+		if u.Index != expected.Index || u.Name != expected.Name || !strings.Contains(u.Email, " [at] ") {
+			t.Errorf("user %d: got %+v, expected %+v", i, u, expected)
+		}
+	}
+
+	var body usersResponse
+	params := url.Values{"browser": {"MSIE"}, "name": {got[0].Name}, "q": {`NOT country="Nowhere"`}}
+	if getJSON(t, ts, "/users", params, &body); body.Response.Total == 0 {
+		t.Errorf("no users for %v", params)
+	}
+
+	var projected usersResponse
+	params = url.Values{"company": {srv.Dataset().Users[0].Company}, "fields": {"name,phone"}}
+	if getJSON(t, ts, "/users", params, &projected); projected.Response.Total == 0 {
+		t.Errorf("no users for %v", params)
+	} else if u := projected.Response.Users[0]; u.Phone == "" || u.Email != "" || u.Browsers != nil {
+		t.Errorf("expected only name and phone, got %+v", u)
+	}
+
+	if code := getJSON(t, ts, "/users", url.Values{"limit": {"-1"}}, &body); code != http.StatusBadRequest || body.Error == "" {
+		t.Errorf("expected bad request for negative limit, got %d %q", code, body.Error)
+	}
+	if code := getJSON(t, ts, "/users", url.Values{"q": {`browser~`}}, &body); code != http.StatusBadRequest {
+		t.Errorf("expected bad request for bad query, got %d", code)
+	}
+}
+
+func TestServerBrowserStats(t *testing.T) {
+	_, ts, path := newTestServer(t, 1000)
+	scanned, err := scanPath(path, defaultQuery, ScanOptions{Errors: ErrorPolicy{Mode: ErrorSkip}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var body struct{ Response browserStats }
+	getJSON(t, ts, "/stats/browsers", url.Values{"browser": {"Android", "MSIE"}}, &body)
+	if body.Response.UniqueBrowsers != scanned.seen.Count() || body.Response.Matched != len(scanned.found) || body.Response.Lines != 1000 {
+		t.Errorf("got %+v, expected %+v", body.Response, scanned.stats())
+	}
+
+	getJSON(t, ts, "/stats/browsers", nil, &body)
+	if body.Response.Matched != 999 || body.Response.UniqueBrowsers <= scanned.seen.Count() {
+		t.Errorf("unfiltered stats %+v", body.Response)
+	}
+}
+
+func TestServerReload(t *testing.T) {
+	srv, ts, path := newTestServer(t, 100)
+	old := srv.Dataset()
+
+	reload := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		srv.Watch(ctx, 10*time.Millisecond, reload)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	writeBrokenUsers(t, path, 300, nil, "")
+	for deadline := time.Now().Add(2 * time.Second); len(srv.Dataset().Users) != 300; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("dataset is not reloaded, %d users", len(srv.Dataset().Users))
+		}
+	}
+
+	// старый датасет не трогается - запросы, начатые до перезагрузки, его дочитывают
+	if len(old.Users) != 99 {
+		t.Errorf("old dataset changed: %d users", len(old.Users))
+	}
+
+	var body usersResponse
+	getJSON(t, ts, "/users", url.Values{"limit": {"1"}}, &body)
+	if body.Response.Total != 300 {
+		t.Errorf("expected 300 users after reload, got %d", body.Response.Total)
+	}
+
+	// неудачная перезагрузка оставляет прежние данные
+	os.Remove(path)
+	reload <- os.Interrupt
+	time.Sleep(50 * time.Millisecond)
+	if len(srv.Dataset().Users) != 300 {
+		t.Errorf("dataset lost after failed reload")
+	}
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Снапшот - бинарная копия файла пользователей только с полями, нужными поиску.
+//
+//	magic "HW3SNAP2"
+//	записи по одной на строку исходного файла:
+//	  0, длина строки, name, email, id страны, company, job, phone, число браузеров, id браузеров... - пользователь
+//	  1, длина строки, строка как есть, текст ошибки - строка, которая не разобралась
+//	хвост: размер и время изменения исходного файла, число строк, таблица строк (браузеры и страны)
+//	смещение хвоста, 8 байт little endian
+//
+// Числа - uvarint, строки - uvarint длина и байты. Смещения строк исходного файла восстанавливаются по длинам.
+// Снапшот читается целиком в одну строку, поля пользователей - её подстроки, поэтому чтение почти не аллоцирует
+const snapshotMagic = "HW3SNAP2"
+
+const (
+	snapUser = iota
+	snapMalformed
+)
+
+var errBadSnapshot = errors.New("snapshot: corrupted file")
+
+func SnapshotPath(source string) string {
+	return source + ".snap"
+}
+
+// BuildSnapshot читает source (в том числе сжатый gzip) и пишет снапшот в snapPath.
+// Файл пишется во временный и переименовывается, так что читатели не увидят недописанный снапшот
+func BuildSnapshot(source, snapPath string) error {
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	src, _, err := openSource(in)
+	if err != nil {
+		return err
+	}
+
+	tmp := snapPath + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := writeSnapshot(out, src, info); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, snapPath)
+}
+
+type snapshotWriter struct {
+	w       *bufio.Writer
+	written int64
+	ids     map[string]uint64
+	strs    []string
+	buf     [binary.MaxVarintLen64]byte
+}
+
+func (s *snapshotWriter) write(data []byte) {
+	n, _ := s.w.Write(data)
+	s.written += int64(n)
+}
+
+func (s *snapshotWriter) uvarint(x uint64) {
+	s.write(s.buf[:binary.PutUvarint(s.buf[:], x)])
+}
+
+func (s *snapshotWriter) bytes(data []byte) {
+	s.uvarint(uint64(len(data)))
+	s.write(data)
+}
+
+func (s *snapshotWriter) string(str string) {
+	s.uvarint(uint64(len(str)))
+	n, _ := s.w.WriteString(str)
+	s.written += int64(n)
+}
+
+func (s *snapshotWriter) intern(str string) uint64 {
+	id, ok := s.ids[str]
+	if !ok {
+		id = uint64(len(s.strs))
+		s.ids[str] = id
+		s.strs = append(s.strs, str)
+	}
+	return id
+}
+
+func writeSnapshot(out io.Writer, src io.Reader, info os.FileInfo) error {
+	s := &snapshotWriter{w: bufio.NewWriter(out), ids: make(map[string]uint64)}
+	s.write([]byte(snapshotMagic))
+
+	scanner := bufio.NewScanner(src)
+	var lines uint64
+	var user User
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		lines++
+
+		if err := user.DecodeJSON(line); err != nil {
+			s.write([]byte{snapMalformed})
+			s.uvarint(uint64(len(line)))
+			s.bytes(line)
+			s.string(err.Error())
+			continue
+		}
+
+		s.write([]byte{snapUser})
+		s.uvarint(uint64(len(line)))
+		s.string(user.Name)
+		s.string(user.Email)
+		s.uvarint(s.intern(user.Country))
+		s.string(user.Company)
+		s.string(user.Job)
+		s.string(user.Phone)
+		s.uvarint(uint64(len(user.Browsers)))
+		for _, browser := range user.Browsers {
+			s.uvarint(s.intern(browser))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	trailer := s.written
+	s.uvarint(uint64(info.Size()))
+	s.uvarint(uint64(info.ModTime().UnixNano()))
+	s.uvarint(lines)
+	s.uvarint(uint64(len(s.strs)))
+	for _, str := range s.strs {
+		s.string(str)
+	}
+	binary.LittleEndian.PutUint64(s.buf[:8], uint64(trailer))
+	s.write(s.buf[:8])
+
+	return s.w.Flush()
+}
+
+// snapshot - прочитанный снапшот, records - часть файла с записями
+type snapshot struct {
+	records string
+	size    uint64
+	modTime int64
+	lines   int
+	strs    []string
+}
+
+// snapReader разбирает uvarint и строки прямо из строки, без копирования
+type snapReader struct {
+	s   string
+	err error
+}
+
+func (r *snapReader) uvarint() uint64 {
+	var x uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if len(r.s) == 0 {
+			break
+		}
+		b := r.s[0]
+		r.s = r.s[1:]
+		x |= uint64(b&0x7f) << shift
+		if b < 0x80 {
+			return x
+		}
+	}
+	r.err = errBadSnapshot
+	return 0
+}
+
+func (r *snapReader) byte() byte {
+	if len(r.s) == 0 {
+		r.err = errBadSnapshot
+		return 0
+	}
+	b := r.s[0]
+	r.s = r.s[1:]
+	return b
+}
+
+func (r *snapReader) string() string {
+	n := r.uvarint()
+	if n > uint64(len(r.s)) {
+		r.err = errBadSnapshot
+		return ""
+	}
+	str := r.s[:n]
+	r.s = r.s[n:]
+	return str
+}
+
+// loadSnapshot читает снапшот snapPath одной аллокацией под данные
+func loadSnapshot(snapPath string) (*snapshot, error) {
+	file, err := os.Open(snapPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	var sb strings.Builder
+	sb.Grow(int(info.Size()))
+	if _, err := io.Copy(&sb, file); err != nil {
+		return nil, err
+	}
+	return parseSnapshot(sb.String())
+}
+
+func parseSnapshot(data string) (*snapshot, error) {
+	if len(data) < len(snapshotMagic)+8 || !strings.HasPrefix(data, snapshotMagic) {
+		return nil, errBadSnapshot
+	}
+
+	end := len(data) - 8
+	trailer := binary.LittleEndian.Uint64([]byte(data[end:]))
+	if trailer < uint64(len(snapshotMagic)) || trailer > uint64(end) {
+		return nil, errBadSnapshot
+	}
+
+	snap := &snapshot{records: data[len(snapshotMagic):trailer]}
+	r := &snapReader{s: data[trailer:end]}
+	snap.size = r.uvarint()
+	snap.modTime = int64(r.uvarint())
+	snap.lines = int(r.uvarint())
+	n := r.uvarint()
+	if n > uint64(len(r.s)) {
+		return nil, errBadSnapshot
+	}
+	snap.strs = make([]string, n)
+	for i := range snap.strs {
+		snap.strs[i] = r.string()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return snap, nil
+}
+
+// fresh - снапшот сделан с текущей версии исходного файла
+func (snap *snapshot) fresh(info os.FileInfo) bool {
+	return snap.size == uint64(info.Size()) && snap.modTime == info.ModTime().UnixNano()
+}
+
+// openSnapshot возвращает снапшот для source, если он есть и не устарел, иначе nil.
+// Битый или устаревший снапшот не ошибка - поиск просто читает JSON
+func openSnapshot(source string) *snapshot {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil
+	}
+	snap, err := loadSnapshot(SnapshotPath(source))
+	if err != nil || !snap.fresh(info) {
+		return nil
+	}
+	return snap
+}
+
+// scan - аналог scanUsers по снапшоту, результат тот же
+func (snap *snapshot) scan(q *Query, opts ScanOptions) (scanResult, error) {
+	seen, err := newBrowserCounter(opts)
+	if err != nil {
+		return scanResult{}, err
+	}
+
+	matcher := q.NewMatcher()
+	res := scanResult{seen: seen}
+	r := &snapReader{s: snap.records}
+	var offset int64
+	var user User
+
+	for len(r.s) > 0 {
+		tag := r.byte()
+		lineLen := int64(r.uvarint())
+
+		switch tag {
+		case snapUser:
+			user.Name = r.string()
+			user.Email = r.string()
+			user.Country = snap.str(r.uvarint(), r)
+			user.Company = r.string()
+			user.Job = r.string()
+			user.Phone = r.string()
+			user.Browsers = user.Browsers[:0]
+			for n := r.uvarint(); n > 0 && r.err == nil; n-- {
+				user.Browsers = append(user.Browsers, snap.str(r.uvarint(), r))
+			}
+			if r.err != nil {
+				return res, r.err
+			}
+			if matcher.Match(&user, res.seen) {
+				res.found = append(res.found, newFoundUser(res.lines, &user, matcher))
+			}
+
+		case snapMalformed:
+			line, msg := r.string(), r.string()
+			if r.err != nil {
+				return res, r.err
+			}
+			bad, err := opts.Errors.lineError([]byte(line), res.lines+1, offset, errors.New(msg))
+			if err != nil {
+				return res, err
+			}
+			res.bad = append(res.bad, bad)
+
+		default:
+			return res, errBadSnapshot
+		}
+
+		offset += lineLen + 1
+		res.lines++
+	}
+
+	if res.lines != snap.lines {
+		return res, fmt.Errorf("snapshot: expected %d lines, got %d", snap.lines, res.lines)
+	}
+	return res, nil
+}
+
+func (snap *snapshot) str(id uint64, r *snapReader) string {
+	if id >= uint64(len(snap.strs)) {
+		r.err = errBadSnapshot
+		return ""
+	}
+	return snap.strs[id]
+}
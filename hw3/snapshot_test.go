@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func searchFile(t *testing.T, path string, opts ScanOptions) (string, error) {
+	out := new(bytes.Buffer)
+	err := SearchFiles(NewTextWriter(out), []string{path}, defaultQuery, nil, opts)
+	return out.String(), err
+}
+
+func TestSnapshotSearch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	writeBrokenUsers(t, path, 1000, []int{10, 500}, "{broken")
+
+	skip := ScanOptions{Errors: ErrorPolicy{Mode: ErrorSkip}}
+	expected, err := searchFile(t, path, skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, expectedErr := searchFile(t, path, ScanOptions{})
+
+	if err := BuildSnapshot(path, SnapshotPath(path)); err != nil {
+		t.Fatal(err)
+	}
+	if openSnapshot(path) == nil {
+		t.Fatal("fresh snapshot is not used")
+	}
+
+	got, err := searchFile(t, path, skip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, expected)
+	}
+
+	var lerr *LineError
+	_, err = searchFile(t, path, ScanOptions{})
+	if !errors.As(err, &lerr) || err.Error() != expectedErr.Error() {
+		t.Errorf("expected %v, got %v", expectedErr, err)
+	}
+}
+
+func TestSnapshotStale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	writeBrokenUsers(t, path, 1000, nil, "")
+	if err := BuildSnapshot(path, SnapshotPath(path)); err != nil {
+		t.Fatal(err)
+	}
+
+	// файл изменился после снапшота - должен читаться JSON
+	writeBrokenUsers(t, path, 600, nil, "")
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(path, later, later)
+	if openSnapshot(path) != nil {
+		t.Fatal("stale snapshot is used")
+	}
+
+	expected := new(bytes.Buffer)
+	scanned, err := scanPath(path, defaultQuery, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeAll(NewTextWriter(expected), scanned.found, scanned.stats())
+
+	got, err := searchFile(t, path, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != expected.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", got, expected)
+	}
+
+	// испорченный снапшот тоже не ошибка
+	os.WriteFile(SnapshotPath(path), []byte(snapshotMagic+"garbage"), 0644)
+	if openSnapshot(path) != nil {
+		t.Error("corrupted snapshot is used")
+	}
+}
+
+func TestSnapshotAllocs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	writeBrokenUsers(t, path, 1000, nil, "")
+	if err := BuildSnapshot(path, SnapshotPath(path)); err != nil {
+		t.Fatal(err)
+	}
+	snap := openSnapshot(path)
+
+	allocs := testing.AllocsPerRun(10, func() {
+		snap.scan(defaultQuery, ScanOptions{})
+	})
+	// аллоцируются только найденные пользователи и карта уникальных браузеров, не строки
+	if allocs > 300 {
+		t.Errorf("too many allocations for 1000 lines: %v", allocs)
+	}
+}
+
+func BenchmarkSnapshot(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "users.snap")
+	if err := BuildSnapshot(filePath, path); err != nil {
+		b.Fatal(err)
+	}
+	snap, err := loadSnapshot(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		snap.scan(defaultQuery, ScanOptions{})
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Progress - отчёт об обработке одного файла из списка
+type Progress struct {
+	Path  string
+	File  int // номер файла, с 1
+	Files int
+	Lines int
+	Bytes int64 // прочитано с диска, для gzip - в сжатом виде
+	Gzip  bool
+}
+
+type ProgressFunc func(p Progress)
+
+func (p Progress) String() string {
+	s := fmt.Sprintf("%s [%d/%d]: %d lines, %d bytes", p.Path, p.File, p.Files, p.Lines, p.Bytes)
+	if p.Gzip {
+		s += " gzip"
+	}
+	return s
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// openSource прозрачно распаковывает gzip, определяя его по сигнатуре
+func openSource(r io.Reader) (io.Reader, bool, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(len(gzipMagic))
+	if err != nil && err != io.EOF {
+		return nil, false, err
+	}
+
+	if !bytes.Equal(magic, gzipMagic) {
+		return br, false, nil
+	}
+
+	gz, err := gzip.NewReader(br)
+	if err != nil {
+		return nil, false, err
+	}
+	return gz, true, nil
+}
+
+// readerSource - имя источника в ошибках SearchReader
+const readerSource = "<input>"
+
+// SearchReader ищет пользователей в произвольном потоке, в том числе сжатом gzip
+func SearchReader(w ResultWriter, r io.Reader, q *Query, opts ScanOptions) error {
+	src, _, err := openSource(r)
+	if err != nil {
+		return err
+	}
+
+	res, err := scanUsers(src, q, opts)
+	if err != nil {
+		return withSource(err, readerSource)
+	}
+	if err := opts.Errors.report(readerSource, res.bad); err != nil {
+		return err
+	}
+	return writeAll(w, res.found, res.stats())
+}
+
+// SearchFiles обрабатывает файлы по очереди как один поток: индексы сквозные,
+// уникальные браузеры считаются по всем файлам сразу
+// Плохие строки передаются opts.Errors сразу после обработки своего файла
+func SearchFiles(w ResultWriter, paths []string, q *Query, progress ProgressFunc, opts ScanOptions) error {
+	results := make([]scanResult, 0, len(paths))
+
+	for i, path := range paths {
+		res, p, err := scanFile(path, q, opts)
+		if err != nil {
+			if _, ok := err.(*LineError); ok {
+				return err
+			}
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if err := opts.Errors.report(path, res.bad); err != nil {
+			return err
+		}
+		results = append(results, res)
+
+		if progress != nil {
+			p.File, p.Files = i+1, len(paths)
+			progress(p)
+		}
+	}
+
+	merged := mergeResults(results)
+	return writeAll(w, merged.found, merged.stats())
+}
+
+// SearchGlob - SearchFiles по всем файлам, подходящим под шаблон, в лексикографическом порядке
+func SearchGlob(w ResultWriter, pattern string, q *Query, progress ProgressFunc, opts ScanOptions) error {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no files match %s", pattern)
+	}
+
+	return SearchFiles(w, paths, q, progress, opts)
+}
+
+// expandPaths раскрывает шаблоны filepath.Glob в списке путей, сохраняя порядок аргументов.
+// Пути без метасимволов остаются как есть, шаблон без совпадений - ошибка
+func expandPaths(args []string) ([]string, error) {
+	paths := make([]string, 0, len(args))
+	for _, arg := range args {
+		if !strings.ContainsAny(arg, "*?[") {
+			paths = append(paths, arg)
+			continue
+		}
+
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %s", arg)
+		}
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// scanFile читает свежий снапшот path, если он есть (см. BuildSnapshot), иначе сам файл
+func scanFile(path string, q *Query, opts ScanOptions) (scanResult, Progress, error) {
+	if snap := openSnapshot(path); snap != nil {
+		res, err := snap.scan(q, opts)
+		if err != nil {
+			return scanResult{}, Progress{}, withSource(err, path)
+		}
+		return res, Progress{Path: path, Lines: res.lines, Bytes: int64(len(snap.records))}, nil
+	}
+
+	if opts.Mmap {
+		res, progress, err := scanMapped(path, q, opts)
+		if err != nil {
+			return scanResult{}, Progress{}, withSource(err, path)
+		}
+		return res, progress, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return scanResult{}, Progress{}, err
+	}
+	defer file.Close()
+
+	counter := &countingReader{r: file}
+	src, isGzip, err := openSource(counter)
+	if err != nil {
+		return scanResult{}, Progress{}, err
+	}
+
+	if opts.Workers > 0 && !isGzip {
+		info, err := file.Stat()
+		if err != nil {
+			return scanResult{}, Progress{}, err
+		}
+		res, err := parallelScan(file, info.Size(), q, opts.Workers, opts)
+		if err != nil {
+			return scanResult{}, Progress{}, withSource(err, path)
+		}
+		return res, Progress{Path: path, Lines: res.lines, Bytes: info.Size()}, nil
+	}
+
+	res, err := scanUsers(src, q, opts)
+	if err != nil {
+		return scanResult{}, Progress{}, withSource(err, path)
+	}
+	return res, Progress{Path: path, Lines: res.lines, Bytes: counter.n, Gzip: isGzip}, nil
+}
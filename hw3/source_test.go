@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func splitUsersFile(t *testing.T, dir string, parts int, compress bool) []string {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(string(data), "\n")
+	per := (len(lines) + parts - 1) / parts
+
+	var paths []string
+	for i := 0; i*per < len(lines); i++ {
+		end := (i + 1) * per
+		if end > len(lines) {
+			end = len(lines)
+		}
+		content := []byte(strings.Join(lines[i*per:end], "\n"))
+
+		path := filepath.Join(dir, "users."+string(rune('a'+i))+".txt")
+		if compress {
+			buf := new(bytes.Buffer)
+			gz := gzip.NewWriter(buf)
+			gz.Write(content)
+			gz.Close()
+			content = buf.Bytes()
+			path += ".gz"
+		}
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestSearchReaderGzip(t *testing.T) {
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+
+	paths := splitUsersFile(t, t.TempDir(), 1, true)
+	file, err := os.Open(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	out := new(bytes.Buffer)
+	if err := SearchReader(NewTextWriter(out), file, defaultQuery, ScanOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, fastOut)
+	}
+}
+
+func TestSearchGlob(t *testing.T) {
+	fastOut := new(bytes.Buffer)
+	FastSearch(fastOut)
+
+	dir := t.TempDir()
+	splitUsersFile(t, dir, 3, false)
+	gzPaths := splitUsersFile(t, t.TempDir(), 3, true)
+
+	var reports []Progress
+	out := new(bytes.Buffer)
+	err := SearchGlob(NewTextWriter(out), filepath.Join(dir, "users.*.txt"), defaultQuery, func(p Progress) {
+		reports = append(reports, p)
+	}, ScanOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != fastOut.String() {
+		t.Errorf("results not match\nGot:\n%v\nExpected:\n%v", out, fastOut)
+	}
+	if len(reports) != 3 || reports[2].File != 3 || reports[0].Lines == 0 {
+		t.Errorf("unexpected progress %+v", reports)
+	}
+
+	out.Reset()
+	if err := SearchFiles(NewTextWriter(out), gzPaths, defaultQuery, nil, ScanOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != fastOut.String() {
+		t.Errorf("gzip results not match\nGot:\n%v\nExpected:\n%v", out, fastOut)
+	}
+
+	if err := SearchGlob(NewTextWriter(out), filepath.Join(dir, "*.csv"), defaultQuery, nil, ScanOptions{}); err == nil {
+		t.Errorf("expected error for empty glob")
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	dir := t.TempDir()
+	txt := splitUsersFile(t, dir, 3, false)
+
+	paths, err := expandPaths([]string{"plain.txt", filepath.Join(dir, "users.*.txt"), "other.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := append(append([]string{"plain.txt"}, txt...), "other.txt")
+	if !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expanded %v, expected %v", paths, expected)
+	}
+
+	if _, err := expandPaths([]string{filepath.Join(dir, "*.csv")}); err == nil {
+		t.Errorf("expected error for empty glob")
+	}
+
+	p := Progress{Path: "users.1.txt.gz", File: 1, Files: 3, Lines: 10, Bytes: 200, Gzip: true}
+	if p.String() != "users.1.txt.gz [1/3]: 10 lines, 200 bytes gzip" {
+		t.Errorf("unexpected progress line %q", p)
+	}
+}
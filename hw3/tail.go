@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"time"
+)
+
+type FollowOptions struct {
+	PollInterval time.Duration
+	// FromEnd - пропустить уже записанные строки и обрабатывать только новые
+	FromEnd bool
+	// Policy - что делать с битыми строками, пропущенные отдаются в Policy сразу
+	Policy ErrorPolicy
+}
+
+// follower хранит состояние слежения за файлом между опросами
+type follower struct {
+	path    string
+	opts    FollowOptions
+	out     ResultWriter
+	matcher *Matcher
+	seen    exactBrowsers
+	matched int
+	skipped int
+
+	file    *os.File
+	started bool
+	offset  int64
+	// lineStart - смещение начала текущей строки, для ошибок
+	lineStart int64
+	partial   []byte
+	index     int
+	user      User
+	buf       []byte
+	// tail - последние прочитанные байты перед offset. Если они изменились, файл обрезали
+	// и дописали заново, даже если он уже не короче offset
+	tail  []byte
+	check []byte
+}
+
+// tailCheckLen - сколько байт перед offset сверяется при каждом опросе
+const tailCheckLen = 64
+
+// Follow работает как tail -f: держит файл открытым, обрабатывает дописанные строки
+// и сразу выводит найденных пользователей. Индексы сквозные с начала слежения,
+// после каждой порции строк выводится статистика, если число уникальных браузеров изменилось
+// и out умеет её выводить (StatsWriter). При остановке вызывается out.Close с итоговой статистикой.
+// Переживает обрезание файла (читает заново с начала) и ротацию (дочитывает старый файл и открывает новый).
+// Строка обрабатывается, когда записан завершающий её '\n'. Пустые строки, как и при полном проходе,
+// считаются битыми и учитываются в индексах. Работает до отмены ctx
+func Follow(ctx context.Context, out ResultWriter, path string, q *Query, opts FollowOptions) error {
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 200 * time.Millisecond
+	}
+
+	f := &follower{
+		path:    path,
+		opts:    opts,
+		out:     out,
+		matcher: q.NewMatcher(),
+		seen:    make(exactBrowsers),
+		buf:     make([]byte, 32*1024),
+		check:   make([]byte, tailCheckLen),
+	}
+	defer f.close()
+	defer func() {
+		out.Close(f.stats())
+	}()
+
+	ticker := time.NewTicker(opts.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := f.poll(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *follower) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+func (f *follower) open(skipExisting bool) error {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	f.file, f.started, f.offset, f.partial, f.tail = file, true, 0, f.partial[:0], f.tail[:0]
+	if skipExisting {
+		if f.offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+		n := f.offset
+		if n > tailCheckLen {
+			n = tailCheckLen
+		}
+		f.tail = f.tail[:n]
+		if _, err := file.ReadAt(f.tail, f.offset-n); err != nil {
+			return err
+		}
+	}
+	f.lineStart = f.offset
+	return nil
+}
+
+// truncated проверяет, что файл не стал короче offset и байты перед offset не изменились
+func (f *follower) truncated() (bool, error) {
+	info, err := f.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() < f.offset {
+		return true, nil
+	}
+
+	check := f.check[:len(f.tail)]
+	if _, err := f.file.ReadAt(check, f.offset-int64(len(check))); err != nil {
+		return false, err
+	}
+	return !bytes.Equal(check, f.tail), nil
+}
+
+// remember дописывает прочитанное в tail, оставляя последние tailCheckLen байт
+func (f *follower) remember(data []byte) {
+	if len(data) >= tailCheckLen {
+		f.tail = append(f.tail[:0], data[len(data)-tailCheckLen:]...)
+		return
+	}
+	f.tail = append(f.tail, data...)
+	if extra := len(f.tail) - tailCheckLen; extra > 0 {
+		f.tail = f.tail[:copy(f.tail, f.tail[extra:])]
+	}
+}
+
+func (f *follower) poll() error {
+	if f.file == nil {
+		if err := f.open(f.opts.FromEnd && !f.started); err != nil {
+			return err
+		}
+		if f.file == nil {
+			return nil
+		}
+	}
+
+	// обрезание проверяется до чтения, иначе дописанное после него прочиталось бы с середины
+	truncated, err := f.truncated()
+	if err != nil {
+		return err
+	}
+	if truncated {
+		f.partial, f.tail = f.partial[:0], f.tail[:0]
+		f.offset, f.lineStart = 0, 0
+		if _, err := f.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	if err := f.readAvailable(); err != nil {
+		return err
+	}
+
+	current, err := os.Stat(f.path)
+	opened, openErr := f.file.Stat()
+	if openErr != nil {
+		return openErr
+	}
+
+	switch {
+	case os.IsNotExist(err) || (err == nil && !os.SameFile(current, opened)):
+		// ротация: старый файл дочитан, недописанную строку считаем последней
+		if err := f.flushPartial(); err != nil {
+			return err
+		}
+		f.close()
+		return nil
+	case err != nil:
+		return err
+	}
+
+	return nil
+}
+
+func (f *follower) readAvailable() error {
+	seenBefore := len(f.seen)
+
+	for {
+		n, err := f.file.Read(f.buf)
+		if n > 0 {
+			f.offset += int64(n)
+			f.remember(f.buf[:n])
+			if err := f.consume(f.buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if sw, ok := f.out.(StatsWriter); ok && len(f.seen) != seenBefore {
+		return sw.WriteStats(f.stats())
+	}
+	return f.out.Flush()
+}
+
+func (f *follower) stats() SearchStats {
+	return SearchStats{Lines: f.index, Matched: f.matched, UniqueBrowsers: len(f.seen), Skipped: f.skipped}
+}
+
+func (f *follower) consume(data []byte) error {
+	for len(data) > 0 {
+		nl := bytes.IndexByte(data, '\n')
+		if nl < 0 {
+			f.partial = append(f.partial, data...)
+			return nil
+		}
+
+		line := data[:nl]
+		if len(f.partial) > 0 {
+			f.partial = append(f.partial, line...)
+			line = f.partial
+		}
+		if err := f.processLine(line); err != nil {
+			return err
+		}
+		f.lineStart += int64(len(line)) + 1
+		f.partial = f.partial[:0]
+		data = data[nl+1:]
+	}
+	return nil
+}
+
+func (f *follower) flushPartial() error {
+	if len(bytes.TrimSpace(f.partial)) == 0 {
+		f.partial = f.partial[:0]
+		return nil
+	}
+	err := f.processLine(f.partial)
+	f.partial = f.partial[:0]
+	return err
+}
+
+func (f *follower) processLine(line []byte) error {
+	if err := f.user.DecodeJSON(line); err != nil {
+		bad, err := f.opts.Policy.lineError(line, f.index+1, f.lineStart, err)
+		if err != nil {
+			return withSource(err, f.path)
+		}
+		f.skipped++
+		f.index++
+		return f.opts.Policy.report(f.path, []badLine{bad})
+	}
+
+	if f.matcher.Match(&f.user, f.seen) {
+		f.matched++
+		if err := f.out.WriteUser(newFoundUser(f.index, &f.user, f.matcher)); err != nil {
+			return err
+		}
+	}
+	f.index++
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func waitFor(t *testing.T, b *syncBuffer, substr string) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if strings.Contains(b.String(), substr) {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timeout waiting for %q, got:\n%s", substr, b.String())
+}
+
+const (
+	tailMatch   = `{"browsers":["Android 4","MSIE 9"],"email":"a@b.c","name":"%s"}`
+	tailNoMatch = `{"browsers":["Opera"],"email":"x@y.z","name":"skip"}`
+)
+
+func tailUser(name string) string {
+	return strings.Replace(tailMatch, "%s", name, 1) + "\n"
+}
+
+func appendFile(t *testing.T, path, data string) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(data)
+	file.Close()
+}
+
+func TestFollow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	appendFile(t, path, tailNoMatch+"\n"+tailUser("first"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := new(syncBuffer)
+	done := make(chan error)
+	go func() {
+		done <- Follow(ctx, NewTextWriter(out), path, defaultQuery, FollowOptions{PollInterval: 5 * time.Millisecond})
+	}()
+
+	waitFor(t, out, "[1] first <a [at] b.c>")
+	waitFor(t, out, "Total unique browsers 2")
+
+	// строка пишется частями
+	line := tailUser("second")
+	appendFile(t, path, line[:10])
+	time.Sleep(20 * time.Millisecond)
+	appendFile(t, path, line[10:])
+	waitFor(t, out, "[2] second")
+
+	// обрезание
+	if err := os.WriteFile(path, []byte(tailUser("truncated")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, out, "[3] truncated")
+
+	// ротация
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	appendFile(t, path, tailUser("rotated"))
+	waitFor(t, out, "[4] rotated")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestFollowRewriteAndEmptyLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	appendFile(t, path, tailUser("first"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	out := new(syncBuffer)
+	var skipped []int
+	var mu sync.Mutex
+	policy := ErrorPolicy{Mode: ErrorSkip, OnSkip: func(err *LineError) {
+		mu.Lock()
+		skipped = append(skipped, err.Line)
+		mu.Unlock()
+	}}
+	done := make(chan error)
+	go func() {
+		done <- Follow(ctx, NewTextWriter(out), path, defaultQuery, FollowOptions{PollInterval: 5 * time.Millisecond, Policy: policy})
+	}()
+	waitFor(t, out, "[0] first")
+
+	// пустая строка - битая, как и при полном проходе, и занимает индекс
+	appendFile(t, path, "\n"+tailUser("after-empty"))
+	waitFor(t, out, "[2] after-empty")
+
+	// файл переписан заново и сразу стал длиннее прежнего: размер не уменьшился, но начало другое
+	rewritten := tailNoMatch + "\n" + tailNoMatch + "\n" + tailNoMatch + "\n" + tailUser("rewritten")
+	if err := os.WriteFile(path, []byte(rewritten), 0644); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, out, "[6] rewritten")
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(skipped) != 1 || skipped[0] != 2 {
+		t.Errorf("expected empty line 2 to be skipped, got %v", skipped)
+	}
+}
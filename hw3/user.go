@@ -0,0 +1,12 @@
+package main
+
+// jsongen:decoder
+type User struct {
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Country  string   `json:"country"`
+	Company  string   `json:"company"`
+	Job      string   `json:"job"`
+	Phone    string   `json:"phone"`
+	Browsers []string `json:"browsers"`
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestUserDecodeJSON(t *testing.T) {
+	lines := []string{
+		`{"browsers":["Opera/9.80","Mozilla/5.0 (Android)"],"company":"Flashpoint","country":"Chile","email":"a@b.c","job":"X #{N}","name":"Sharon","phone":"176-88-49"}`,
+		`{"name":"Esc \"q\" Ж 😀","nested":{"a":[1,2,{"b":"}"}]},"browsers":[],"num":-1.5e3,"flag":true,"email":null}`,
+		` { } `,
+	}
+
+	var user User
+	for _, line := range lines {
+		var expected User
+		if err := json.Unmarshal([]byte(line), &expected); err != nil {
+			t.Fatalf("bad test line %s: %v", line, err)
+		}
+		if err := user.DecodeJSON([]byte(line)); err != nil {
+			t.Errorf("%s: %v", line, err)
+			continue
+		}
+		if len(user.Browsers) == 0 && len(expected.Browsers) == 0 {
+			user.Browsers, expected.Browsers = nil, nil
+		}
+		if !reflect.DeepEqual(user, expected) {
+			t.Errorf("decoded %+v, expected %+v", user, expected)
+		}
+	}
+}
+
+func TestUserDecodeJSONErrors(t *testing.T) {
+	for _, line := range []string{
+		``,
+		`{"name":}`,
+		`{"name":"x"`,
+		`{"browsers":["a",]}`,
+		`{"name":"x"} tail`,
+		`{"name":"\x"}`,
+	} {
+		var user User
+		if err := user.DecodeJSON([]byte(line)); err == nil {
+			t.Errorf("%q: expected error", line)
+		}
+	}
+}
+
+// TestUserDecodeJSONMatchesStdlib - DecodeJSON принимает и отвергает те же строки, что и json.Unmarshal
+func TestUserDecodeJSONMatchesStdlib(t *testing.T) {
+	lines := []string{
+		`{"x":[1,2,]}`,
+		`{"x":01}`,
+		`{"x":-}`,
+		`{"x":1.}`,
+		`{"x":1e}`,
+		`{"x":.5}`,
+		`{"x":-0.5e+3}`,
+		`{"x":"\q"}`,
+		`{"x":"\u12"}`,
+		"{\"x\":\"a\tb\"}",
+		`{"x":{"a":1,}}`,
+		`{"x":{"a" 1}}`,
+		`{"x":{1:2}}`,
+		`{"x":[nul]}`,
+		`{"x":[null,true,false,{"a":[]}]}`,
+		`{"x":tru}`,
+		`{"browsers":["a",null,"b"]}`,
+		`{"browsers":[null]}`,
+		"{\"name\":\"a\xffb\"}",
+		"{\"name\":\"\xe2\x82\"}",
+		"{\"x\":\"\xff\"}",
+		`{"name":"\ud83d\ude00 \ud83d"}`,
+	}
+
+	for _, line := range lines {
+		var expected, user User
+		expectedErr := json.Unmarshal([]byte(line), &expected)
+		err := user.DecodeJSON([]byte(line))
+		if (err == nil) != (expectedErr == nil) {
+			t.Errorf("%q: got error %v, encoding/json got %v", line, err, expectedErr)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if len(user.Browsers) == 0 && len(expected.Browsers) == 0 {
+			user.Browsers, expected.Browsers = nil, nil
+		}
+		if !reflect.DeepEqual(user, expected) {
+			t.Errorf("%q: decoded %+v, expected %+v", line, user, expected)
+		}
+	}
+}
+
+func TestUserDecodeJSONSkipNoAllocs(t *testing.T) {
+	line := []byte(`{"x":{"a":[1,-2.5e3,"\u00e9",null,true]},"name":"Sharon","browsers":["a"]}`)
+	var user User
+	allocs := testing.AllocsPerRun(100, func() {
+		if err := user.DecodeJSONFields(line, 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("skipping fields allocates %v times", allocs)
+	}
+}
+
+func BenchmarkUserDecodeJSON(b *testing.B) {
+	line := []byte(`{"browsers":["Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1"],"company":"Flashpoint","country":"Dominican Republic","email":"JonathanMorris@Muxo.edu","job":"Programmer Analyst #{N}","name":"Sharon Crawford","phone":"176-88-49"}`)
+	var user User
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := user.DecodeJSON(line); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
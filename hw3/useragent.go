@@ -0,0 +1,174 @@
+package main
+
+import (
+	"strings"
+)
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+)
+
+// UserAgent - разобранная строка браузера
+type UserAgent struct {
+	Family  string `json:"family"`
+	Version string `json:"version,omitempty"`
+	OS      string `json:"os"`
+	Device  string `json:"device"`
+}
+
+// uaRule: если в строке есть marker, семейство - family, версия берётся после versionMarker
+// (по умолчанию после самого marker). Правила проверяются по порядку, первое подошедшее выигрывает
+type uaRule struct {
+	marker        string
+	family        string
+	versionMarker string
+	bot           bool
+}
+
+var uaFamilyRules = []uaRule{
+	{marker: "Googlebot", family: "Googlebot", bot: true},
+	{marker: "bingbot", family: "Bingbot", bot: true},
+	{marker: "YandexBot", family: "YandexBot", bot: true},
+	{marker: "Baiduspider", family: "Baiduspider", bot: true},
+	{marker: "msnbot", family: "msnbot", bot: true},
+	{marker: "Mediapartners-Google", family: "Googlebot", bot: true},
+	{marker: "FeedFetcher-Google", family: "Googlebot", bot: true},
+	{marker: "Teoma", family: "Teoma", bot: true},
+	{marker: "Edge/", family: "Edge"},
+	{marker: "Edg/", family: "Edge"},
+	{marker: "OPR/", family: "Opera"},
+	{marker: "Opera Mini/", family: "Opera Mini"},
+	{marker: "Opera", family: "Opera", versionMarker: "Version/"},
+	{marker: "YaBrowser/", family: "Yandex Browser"},
+	{marker: "UCBrowser/", family: "UC Browser"},
+	{marker: "SeaMonkey/", family: "SeaMonkey"},
+	{marker: "Puffin/", family: "Puffin"},
+	{marker: "Arora/", family: "Arora"},
+	{marker: "OmniWeb/", family: "OmniWeb"},
+	{marker: "Fennec/", family: "Firefox Mobile"},
+	{marker: "Firefox/", family: "Firefox"},
+	{marker: "FxiOS/", family: "Firefox"},
+	{marker: "CriOS/", family: "Chrome"},
+	{marker: "Chromium/", family: "Chromium"},
+	{marker: "Chrome/", family: "Chrome"},
+	{marker: "MSIE ", family: "IE"},
+	{marker: "Trident/", family: "IE", versionMarker: "rv:"},
+	{marker: "Konqueror/", family: "Konqueror"},
+	{marker: "Android", family: "Android Browser", versionMarker: "Version/"},
+	{marker: "Safari/", family: "Safari", versionMarker: "Version/"},
+	{marker: "Netscape", family: "Netscape"},
+	{marker: "NetFront/", family: "NetFront"},
+	{marker: "Series60/", family: "Nokia Browser"},
+	{marker: "BlackBerry", family: "BlackBerry"},
+	{marker: "ELinks", family: "ELinks"},
+	{marker: "Links (", family: "Links"},
+	{marker: "w3m/", family: "w3m"},
+}
+
+// uaBotMarkers - признаки роботов, не попавших в uaFamilyRules, ищутся без учёта регистра
+var uaBotMarkers = []string{"bot", "crawl", "spider", "fetcher"}
+
+// uaOSRules проверяются по порядку, у Windows NT версия ядра переводится в название
+var uaOSRules = [][2]string{
+	{"Windows Phone", "Windows Phone"},
+	{"Windows NT 10.0", "Windows 10"},
+	{"Windows NT 6.3", "Windows 8.1"},
+	{"Windows NT 6.2", "Windows 8"},
+	{"Windows NT 6.1", "Windows 7"},
+	{"Windows NT 6.0", "Windows Vista"},
+	{"Windows NT 5.1", "Windows XP"},
+	{"Windows NT 5.0", "Windows 2000"},
+	{"Windows", "Windows"},
+	{"Android", "Android"},
+	{"iPhone", "iOS"},
+	{"iPad", "iOS"},
+	{"iPod", "iOS"},
+	{"CrOS", "Chrome OS"},
+	{"Mac OS X", "macOS"},
+	{"Macintosh", "macOS"},
+	{"BlackBerry", "BlackBerry"},
+	{"BB10", "BlackBerry"},
+	{"SymbianOS", "Symbian"},
+	{"Series40", "Series 40"},
+	{"FreeBSD", "FreeBSD"},
+	{"OpenBSD", "OpenBSD"},
+	{"Linux", "Linux"},
+	{"MIDP", "J2ME"},
+}
+
+var (
+	uaTabletMarkers = []string{"iPad", "Tablet", "Kindle", "Silk/"}
+	uaMobileMarkers = []string{"Mobile", "iPhone", "iPod", "Android", "Windows Phone", "MIDP", "Opera Mini", "BlackBerry", "Symbian", "Series40", "Fennec"}
+)
+
+func ParseUserAgent(ua string) UserAgent {
+	result := UserAgent{Family: "Other", OS: "Other", Device: DeviceDesktop}
+
+	bot := false
+	for _, rule := range uaFamilyRules {
+		if !strings.Contains(ua, rule.marker) {
+			continue
+		}
+
+		result.Family, bot = rule.family, rule.bot
+		versionMarker := rule.versionMarker
+		if versionMarker == "" {
+			versionMarker = rule.marker
+		}
+		result.Version = versionAfter(ua, versionMarker)
+		if result.Version == "" {
+			result.Version = versionAfter(ua, rule.marker)
+		}
+		break
+	}
+
+	for _, rule := range uaOSRules {
+		if strings.Contains(ua, rule[0]) {
+			result.OS = rule[1]
+			break
+		}
+	}
+
+	if !bot && result.Family == "Other" && containsAny(strings.ToLower(ua), uaBotMarkers) {
+		result.Family, bot = "Bot", true
+	}
+
+	switch {
+	case bot:
+		result.Device = DeviceBot
+	case containsAny(ua, uaTabletMarkers):
+		result.Device = DeviceTablet
+	case containsAny(ua, uaMobileMarkers):
+		result.Device = DeviceMobile
+	}
+
+	return result
+}
+
+// versionAfter возвращает версию вида 10.0.1, стоящую сразу после marker (допускается / или пробел)
+func versionAfter(ua, marker string) string {
+	pos := strings.Index(ua, marker)
+	if pos < 0 {
+		return ""
+	}
+
+	rest := ua[pos+len(marker):]
+	rest = strings.TrimLeft(rest, "/ ")
+	end := 0
+	for end < len(rest) && (rest[end] == '.' || (rest[end] >= '0' && rest[end] <= '9')) {
+		end++
+	}
+	return strings.TrimRight(rest[:end], ".")
+}
+
+func containsAny(s string, markers []string) bool {
+	for _, marker := range markers {
+		if strings.Contains(s, marker) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseUserAgent(t *testing.T) {
+	cases := []struct {
+		ua   string
+		want UserAgent
+	}{
+		{
+			"Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1",
+			UserAgent{Family: "Firefox Mobile", Version: "10.0.1", OS: "Android", Device: DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/41.0.2227.0 Safari/537.36",
+			UserAgent{Family: "Chrome", Version: "41.0.2227.0", OS: "Linux", Device: DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (Windows NT 10.0; WOW64; Trident/7.0; MATBJS; rv:11.0) like Gecko",
+			UserAgent{Family: "IE", Version: "11.0", OS: "Windows 10", Device: DeviceDesktop},
+		},
+		{
+			"Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0)",
+			UserAgent{Family: "IE", Version: "7.0", OS: "Windows Vista", Device: DeviceDesktop},
+		},
+		{
+			"Mozilla/5.0 (iPad; CPU OS 5_1 like Mac OS X) AppleWebKit/534.46 (KHTML, like Gecko ) Version/5.1 Mobile/9B176 Safari/7534.48.3",
+			UserAgent{Family: "Safari", Version: "5.1", OS: "iOS", Device: DeviceTablet},
+		},
+		{
+			"Opera/9.80 (J2ME/MIDP; Opera Mini/9.80 (S60; SymbOS; Opera Mobi/23.348; U; en) Presto/2.5.25 Version/10.54",
+			UserAgent{Family: "Opera Mini", Version: "9.80", OS: "J2ME", Device: DeviceMobile},
+		},
+		{
+			"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			UserAgent{Family: "Googlebot", Version: "2.1", OS: "Other", Device: DeviceBot},
+		},
+	}
+
+	for _, c := range cases {
+		if got := ParseUserAgent(c.ua); got != c.want {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", c.ua, got, c.want)
+		}
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	data := strings.Join([]string{
+		`{"browsers":["Mozilla/4.0 (compatible; MSIE 7.0; Windows NT 6.0)","Mozilla/4.0 (compatible; MSIE 8.0; Windows NT 6.1)"],"country":"Chile"}`,
+		`{"browsers":["Mozilla/5.0 (Android; Linux armv7l; rv:10.0.1) Gecko/20100101 Firefox/10.0.1 Fennec/10.0.1"],"country":"Chile"}`,
+		`{"browsers":["Mozilla/4.0 (compatible; MSIE 6.0; Windows NT 5.1)"],"country":"Peru"}`,
+	}, "\n")
+
+	report, err := BuildReport(strings.NewReader(data), ReportFamilies, nil, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Rows) != 2 || report.Rows[0].Keys[0] != "IE" || report.Rows[0].Users != 2 {
+		t.Errorf("unexpected families report %+v", report.Rows)
+	}
+
+	report, err = BuildReport(strings.NewReader(data), ReportCountryBrowser, MustCompileQuery(`country="Chile"`), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Users != 2 || len(report.Rows) != 1 || strings.Join(report.Rows[0].Keys, "/") != "Chile/Firefox Mobile" {
+		t.Errorf("unexpected country report %+v", report)
+	}
+
+	out := new(bytes.Buffer)
+	if err := report.WriteJSON(out); err != nil {
+		t.Fatal(err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(out.Bytes(), &decoded); err != nil || decoded.Users != 2 {
+		t.Errorf("bad json report %s: %v", out, err)
+	}
+
+	if _, err := BuildReport(strings.NewReader(data), "salary", nil, 0); err == nil {
+		t.Errorf("expected error for unknown report")
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -55,21 +56,41 @@ type SearchClient struct {
 	AccessToken string
 	// урл внешней системы, куда идти
 	URL string
+	// Client - http-клиент для запросов, nil - общий клиент с таймаутом в секунду.
+	// Дедлайн контекста действует вместе с таймаутом клиента, срабатывает более ранний.
+	// Чтобы дедлайн мог быть дольше секунды, нужен свой Client с большим таймаутом или без него
+	Client *http.Client
+	// Retry - повтор запроса после временных ошибок, nil - без повторов
+	Retry *RetryPolicy
 }
 
 // FindUsers отправляет запрос во внешнюю систему, которая непосредственно ищет пользоваталей
 func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
+	return srv.FindUsersContext(context.Background(), req)
+}
+
+func (srv *SearchClient) httpClient() *http.Client {
+	if srv.Client != nil {
+		return srv.Client
+	}
+	return client
+}
+
+// FindUsersContext - FindUsers с отменой и дедлайном через ctx. Если запрос прерван из-за ctx,
+// ошибка оборачивает ctx.Err(): errors.Is(err, context.DeadlineExceeded) отличает истёкший дедлайн
+// вызывающего от таймаута сервера ("timeout for ...")
+func (srv *SearchClient) FindUsersContext(ctx context.Context, req SearchRequest) (*SearchResponse, error) {
 
 	searcherParams := url.Values{}
 
 	if req.Limit < 0 {
-		return nil, fmt.Errorf("limit must be > 0")
+		return nil, ErrBadLimit
 	}
 	if req.Limit > 25 {
 		req.Limit = 25
 	}
 	if req.Offset < 0 {
-		return nil, fmt.Errorf("offset must be > 0")
+		return nil, ErrBadOffset
 	}
 
 	//нужно для получения следующей записи, на основе которой мы скажем - можно показать переключатель следующей страницы или нет
@@ -81,40 +102,72 @@ func (srv *SearchClient) FindUsers(req SearchRequest) (*SearchResponse, error) {
 	searcherParams.Add("order_field", req.OrderField)
 	searcherParams.Add("order_by", strconv.Itoa(req.OrderBy))
 
-	searcherReq, err := http.NewRequest("GET", srv.URL+"?"+searcherParams.Encode(), nil)
+	searcherReq, err := http.NewRequestWithContext(ctx, "GET", srv.URL+"?"+searcherParams.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("cant create request: %w", err)
+	}
 	searcherReq.Header.Add("AccessToken", srv.AccessToken)
 
-	resp, err := client.Do(searcherReq)
+	for attempt := 1; ; attempt++ {
+		result, err := srv.find(ctx, searcherReq, searcherParams, req)
+		if err == nil {
+			return result, nil
+		}
+		delay, ok := srv.Retry.next(ctx, attempt, err)
+		if !ok {
+			return nil, err
+		}
+		if err := sleepContext(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// find - одна попытка запроса
+func (srv *SearchClient) find(ctx context.Context, searcherReq *http.Request, searcherParams url.Values, req SearchRequest) (*SearchResponse, error) {
+	resp, err := srv.httpClient().Do(searcherReq)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("search %s: %w", searcherParams.Encode(), ctx.Err())
+		}
 		if err, ok := err.(net.Error); ok && err.Timeout() {
-			return nil, fmt.Errorf("timeout for %s", searcherParams.Encode())
+			return nil, &TimeoutError{Params: searcherParams.Encode()}
 		}
-		return nil, fmt.Errorf("unknown error %s", err)
+		return nil, fmt.Errorf("unknown error %w", err)
 	}
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("search %s: %w", searcherParams.Encode(), ctx.Err())
+		}
+		return nil, fmt.Errorf("cant read response: %w", err)
+	}
 
 	switch resp.StatusCode {
+	case http.StatusOK:
 	case http.StatusUnauthorized:
-		return nil, fmt.Errorf("Bad AccessToken")
+		return nil, &HTTPStatusError{Code: resp.StatusCode, Body: string(body), err: ErrBadAccessToken}
 	case http.StatusInternalServerError:
-		return nil, fmt.Errorf("SearchServer fatal error")
+		return nil, &HTTPStatusError{Code: resp.StatusCode, Body: string(body), err: ErrServerFatal}
 	case http.StatusBadRequest:
 		errResp := SearchErrorResponse{}
 		err = json.Unmarshal(body, &errResp)
 		if err != nil {
-			return nil, fmt.Errorf("cant unpack error json: %s", err)
+			return nil, fmt.Errorf("cant unpack error json: %w", err)
 		}
 		if errResp.Error == "ErrorBadOrderField" {
-			return nil, fmt.Errorf("OrderFeld %s invalid", req.OrderField)
+			return nil, &BadOrderFieldError{Field: req.OrderField}
 		}
-		return nil, fmt.Errorf("unknown bad request error: %s", errResp.Error)
+		return nil, &HTTPStatusError{Code: resp.StatusCode, Body: errResp.Error}
+	default:
+		return nil, &HTTPStatusError{Code: resp.StatusCode, Body: string(body), RetryAfter: retryAfter(resp, time.Now())}
 	}
 
 	data := []User{}
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		return nil, fmt.Errorf("cant unpack result json: %s", err)
+		return nil, fmt.Errorf("cant unpack result json: %w", err)
 	}
 
 	result := SearchResponse{}
@@ -1,16 +1,20 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"sort"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
-    "sort"
-    "encoding/json"
 )
 
 // ---- структуры для SearchServer ----
@@ -137,19 +141,31 @@ func SearchServer(w http.ResponseWriter, r *http.Request) {
 }
 
 // ---- вспомогательные сортировки ----
-func SortByIdAsc(users []User)    { sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id }) }
-func SortByIdDesc(users []User)   { sort.Slice(users, func(i, j int) bool { return users[i].Id > users[j].Id }) }
-func SortByAgeAsc(users []User)   { sort.Slice(users, func(i, j int) bool { return users[i].Age < users[j].Age }) }
-func SortByAgeDesc(users []User)  { sort.Slice(users, func(i, j int) bool { return users[i].Age > users[j].Age }) }
-func SortByNameAsc(users []User)  { sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name }) }
-func SortByNameDesc(users []User) { sort.Slice(users, func(i, j int) bool { return users[i].Name > users[j].Name }) }
+func SortByIdAsc(users []User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
+}
+func SortByIdDesc(users []User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Id > users[j].Id })
+}
+func SortByAgeAsc(users []User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Age < users[j].Age })
+}
+func SortByAgeDesc(users []User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Age > users[j].Age })
+}
+func SortByNameAsc(users []User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+}
+func SortByNameDesc(users []User) {
+	sort.Slice(users, func(i, j int) bool { return users[i].Name > users[j].Name })
+}
 
 // ---- вспомогательная функция теста ----
-func RunClientTest(t *testing.T, client *SearchClient, req SearchRequest, wantErr string, wantUsers int) {
+func RunClientTest(t *testing.T, client *SearchClient, req SearchRequest, wantErr error, wantUsers int) {
 	resp, err := client.FindUsers(req)
-	if wantErr != "" {
-		if err == nil || !strings.Contains(err.Error(), wantErr) {
-			t.Errorf("expected error %q, got %v", wantErr, err)
+	if wantErr != nil {
+		if !errors.Is(err, wantErr) {
+			t.Errorf("expected error %v, got %v", wantErr, err)
 		}
 		return
 	}
@@ -172,14 +188,15 @@ func TestSearchClient_AllCases(t *testing.T) {
 	tests := []struct {
 		name      string
 		req       SearchRequest
-		wantErr   string
+		wantErr   error
 		wantUsers int
 	}{
-		{"Limit negative", SearchRequest{Limit: -1}, "limit must be > 0", 0},
-		{"Offset negative", SearchRequest{Limit: 1, Offset: -1}, "offset must be > 0", 0},
-		{"Bad order field", SearchRequest{Limit: 1, OrderField: "Unknown"}, "OrderFeld", 0},
-		{"Valid request small limit", SearchRequest{Limit: 2, Offset: 0}, "", 2},
-		{"Valid request with query", SearchRequest{Limit: 3, Offset: 0, Query: "Boyd Wolf"}, "", 1},
+		{"Limit negative", SearchRequest{Limit: -1}, ErrBadLimit, 0},
+		{"Offset negative", SearchRequest{Limit: 1, Offset: -1}, ErrBadOffset, 0},
+		{"Bad order field", SearchRequest{Limit: 1, OrderField: "Unknown"}, &BadOrderFieldError{Field: "Unknown"}, 0},
+		{"Valid request small limit", SearchRequest{Limit: 2, Offset: 0}, nil, 2},
+		{"Valid request with query", SearchRequest{Limit: 3, Offset: 0, Query: "Boyd Wolf"}, nil, 1},
+		{"Limit capped", SearchRequest{Limit: 30}, nil, 25},
 	}
 
 	for _, tt := range tests {
@@ -199,6 +216,39 @@ func TestSearchClient_Timeout(t *testing.T) {
 	if err == nil || !strings.Contains(err.Error(), "timeout") {
 		t.Errorf("expected timeout error, got %v", err)
 	}
+
+	// таймауты сервера и клиента равны, поэтому первым может сработать любой из них
+	var timeout *TimeoutError
+	var status *HTTPStatusError
+	switch {
+	case errors.As(err, &timeout):
+		if !strings.Contains(timeout.Params, "query=sleep") {
+			t.Errorf("expected request params in timeout, got %q", timeout.Params)
+		}
+	case errors.As(err, &status):
+		if status.Code != http.StatusServiceUnavailable || errors.Is(err, ErrServerFatal) {
+			t.Errorf("expected 503 status error, got %v", err)
+		}
+	default:
+		t.Errorf("expected *TimeoutError or *HTTPStatusError, got %T %v", err, err)
+	}
+}
+
+func TestSearchClient_ServerTimeout(t *testing.T) {
+	// таймаут сервера раньше клиентского: 503 от TimeoutHandler - ошибка статуса, а не таймаут клиента
+	ts := httptest.NewServer(http.TimeoutHandler(http.HandlerFunc(SearchServer), 100*time.Millisecond, "timeout"))
+	defer ts.Close()
+
+	client := &SearchClient{AccessToken: "token", URL: ts.URL}
+	_, err := client.FindUsers(SearchRequest{Limit: 1, Query: "sleep"})
+	var status *HTTPStatusError
+	var timeout *TimeoutError
+	if !errors.As(err, &status) || status.Code != http.StatusServiceUnavailable || status.Body != "timeout" {
+		t.Fatalf("expected 503 status error, got %v", err)
+	}
+	if errors.Is(err, ErrServerFatal) || errors.As(err, &timeout) {
+		t.Errorf("server timeout must not be ErrServerFatal or *TimeoutError: %v", err)
+	}
 }
 
 func TestSearchClient_Unauthorized(t *testing.T) {
@@ -207,7 +257,8 @@ func TestSearchClient_Unauthorized(t *testing.T) {
 	client := &SearchClient{URL: ts.URL}
 	req := SearchRequest{Limit: 1, Offset: 0}
 	_, err := client.FindUsers(req)
-	if err == nil || !strings.Contains(err.Error(), "Bad AccessToken") {
+	var status *HTTPStatusError
+	if !errors.Is(err, ErrBadAccessToken) || !errors.As(err, &status) || status.Code != http.StatusUnauthorized {
 		t.Errorf("expected unauthorized error, got %v", err)
 	}
 }
@@ -222,7 +273,371 @@ func TestSearchClient_InternalServerError(t *testing.T) {
 	client := &SearchClient{AccessToken: "token", URL: ts.URL}
 	req := SearchRequest{Limit: 1, Offset: 0}
 	_, err := client.FindUsers(req)
-	if err == nil || !strings.Contains(err.Error(), "SearchServer fatal error") {
+	if !errors.Is(err, ErrServerFatal) {
 		t.Errorf("expected internal server error, got %v", err)
 	}
-}
\ No newline at end of file
+}
+
+// блокирующий сервер: отвечает, только когда клиент уходит. Если flush, заголовки отправляются сразу
+func hangingServer(flush bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if flush {
+			w.WriteHeader(http.StatusOK)
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+}
+
+func TestSearchClient_Context(t *testing.T) {
+	for _, flush := range []bool{false, true} {
+		ts := hangingServer(flush)
+		client := &SearchClient{AccessToken: "token", URL: ts.URL}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		_, err := client.FindUsersContext(ctx, SearchRequest{Limit: 1})
+		cancel()
+		var timeout *TimeoutError
+		if !errors.Is(err, context.DeadlineExceeded) || errors.As(err, &timeout) {
+			t.Errorf("flush %v: expected deadline exceeded, got %v", flush, err)
+		}
+
+		ctx, cancel = context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+		_, err = client.FindUsersContext(ctx, SearchRequest{Limit: 1})
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("flush %v: expected canceled, got %v", flush, err)
+		}
+		ts.Close()
+	}
+}
+
+func TestSearchClient_InjectedClient(t *testing.T) {
+	ts := hangingServer(false)
+	defer ts.Close()
+
+	// таймаут клиента - это таймаут сервера, а не дедлайн вызывающего
+	client := &SearchClient{AccessToken: "token", URL: ts.URL, Client: &http.Client{Timeout: 50 * time.Millisecond}}
+	_, err := client.FindUsersContext(context.Background(), SearchRequest{Limit: 1})
+	var timeout *TimeoutError
+	if !errors.As(err, &timeout) || errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected server timeout, got %v", err)
+	}
+}
+
+func TestSearchClient_DeadlineAndTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(1200 * time.Millisecond)
+		SearchServer(w, r)
+	}))
+	defer slow.Close()
+	client := &SearchClient{AccessToken: "token", URL: slow.URL}
+
+	// таймаут клиента по умолчанию раньше дедлайна - он и срабатывает
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var timeout *TimeoutError
+	if _, err := client.FindUsersContext(ctx, SearchRequest{Limit: 1}); !errors.As(err, &timeout) {
+		t.Errorf("expected default timeout before a loose deadline, got %v", err)
+	}
+
+	// дедлайн раньше таймаута
+	short, cancelShort := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelShort()
+	if _, err := client.FindUsersContext(short, SearchRequest{Limit: 1}); !errors.Is(err, context.DeadlineExceeded) || errors.As(err, &timeout) {
+		t.Errorf("expected deadline exceeded, got %v", err)
+	}
+
+	// свой клиент без таймаута - действует только дедлайн
+	client.Client = &http.Client{}
+	resp, err := client.FindUsersContext(ctx, SearchRequest{Limit: 1})
+	if err != nil || len(resp.Users) != 1 {
+		t.Errorf("expected 1 user with own client and a loose deadline, got %+v, %v", resp, err)
+	}
+}
+
+func TestSearchClient_RequestErrors(t *testing.T) {
+	client := &SearchClient{AccessToken: "token", URL: "http://bad\x7furl"}
+	if _, err := client.FindUsers(SearchRequest{Limit: 1}); err == nil || !strings.Contains(err.Error(), "cant create request") {
+		t.Errorf("expected request error, got %v", err)
+	}
+
+	// обрыв ответа посередине тела
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "100")
+		w.Write([]byte(`[{"Id":1`))
+	}))
+	defer ts.Close()
+	client = &SearchClient{AccessToken: "token", URL: ts.URL}
+	if _, err := client.FindUsers(SearchRequest{Limit: 1}); err == nil || !strings.Contains(err.Error(), "cant read response") {
+		t.Errorf("expected read error, got %v", err)
+	}
+}
+
+func TestSearchClient_StatusErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"Unknown bad request", http.StatusBadRequest, `{"error":"ErrorBadLimit"}`, http.StatusBadRequest, "ErrorBadLimit"},
+		{"Unavailable", http.StatusServiceUnavailable, "maintenance", http.StatusServiceUnavailable, "maintenance"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			client := &SearchClient{AccessToken: "token", URL: ts.URL}
+			_, err := client.FindUsers(SearchRequest{Limit: 1})
+			var status *HTTPStatusError
+			if !errors.As(err, &status) || status.Code != tt.wantCode || status.Body != tt.wantBody {
+				t.Errorf("expected status %d %q, got %v", tt.wantCode, tt.wantBody, err)
+			}
+			if errors.Is(err, ErrServerFatal) || errors.Is(err, ErrBadAccessToken) {
+				t.Errorf("unexpected sentinel in %v", err)
+			}
+		})
+	}
+}
+
+func TestSearchClient_BadJSON(t *testing.T) {
+	for _, status := range []int{http.StatusOK, http.StatusBadRequest} {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			w.Write([]byte(`{broken`))
+		}))
+		client := &SearchClient{AccessToken: "token", URL: ts.URL}
+		_, err := client.FindUsers(SearchRequest{Limit: 1})
+		var syntax *json.SyntaxError
+		if !errors.As(err, &syntax) {
+			t.Errorf("status %d: expected json syntax error, got %v", status, err)
+		}
+		ts.Close()
+	}
+}
+
+func TestSearchClient_ConnectionError(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(SearchServer))
+	ts.Close()
+
+	client := &SearchClient{AccessToken: "token", URL: ts.URL}
+	_, err := client.FindUsers(SearchRequest{Limit: 1})
+	var netErr net.Error
+	if !errors.As(err, &netErr) || netErr.Timeout() {
+		t.Errorf("expected connection error, got %v", err)
+	}
+}
+
+func TestErrorMessages(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{&BadOrderFieldError{Field: "About"}, "OrderField About invalid"},
+		{&TimeoutError{Params: "limit=2"}, "timeout for limit=2"},
+		{&HTTPStatusError{Code: 401, err: ErrBadAccessToken}, "Bad AccessToken (status 401)"},
+		{&HTTPStatusError{Code: 503, Body: "maintenance"}, "SearchServer status 503: maintenance"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("got %q, want %q", got, tt.want)
+		}
+	}
+	if !(&TimeoutError{}).Timeout() {
+		t.Error("TimeoutError must report Timeout() == true")
+	}
+}
+
+// flakyServer отвечает failures[i] на i-й запрос, а когда они кончаются - как SearchServer
+func flakyServer(calls *int32, failures ...func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(atomic.AddInt32(calls, 1))
+		if n <= len(failures) {
+			failures[n-1](w, r)
+			return
+		}
+		SearchServer(w, r)
+	}))
+}
+
+func status(code int, retryAfter string) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func hang(w http.ResponseWriter, r *http.Request) {
+	<-r.Context().Done()
+}
+
+func TestSearchClient_Retry(t *testing.T) {
+	fast := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	tests := []struct {
+		name      string
+		policy    *RetryPolicy
+		failures  []func(w http.ResponseWriter, r *http.Request)
+		wantErr   error
+		wantCalls int32
+	}{
+		{"No policy", nil, []func(http.ResponseWriter, *http.Request){status(500, "")}, ErrServerFatal, 1},
+		{"Recovers after 500 and 502", &fast, []func(http.ResponseWriter, *http.Request){status(500, ""), status(502, "")}, nil, 3},
+		{"Gives up after MaxAttempts", &fast, []func(http.ResponseWriter, *http.Request){status(500, ""), status(500, ""), status(500, "")}, ErrServerFatal, 3},
+		{"Not retryable status", &fast, []func(http.ResponseWriter, *http.Request){status(401, "")}, ErrBadAccessToken, 1},
+		{"Custom statuses", &RetryPolicy{MaxAttempts: 3, Statuses: []int{http.StatusTeapot}}, []func(http.ResponseWriter, *http.Request){status(http.StatusTeapot, ""), status(500, "")}, ErrServerFatal, 2},
+		{"Timeout", &fast, []func(http.ResponseWriter, *http.Request){hang}, nil, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			ts := flakyServer(&calls, tt.failures...)
+			defer ts.Close()
+
+			client := &SearchClient{AccessToken: "token", URL: ts.URL, Retry: tt.policy, Client: &http.Client{Timeout: 100 * time.Millisecond}}
+			resp, err := client.FindUsers(SearchRequest{Limit: 2})
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) || tt.wantErr == nil && (err != nil || len(resp.Users) != 2) {
+				t.Errorf("expected %v, got %+v, %v", tt.wantErr, resp, err)
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("expected %d calls, got %d", tt.wantCalls, calls)
+			}
+		})
+	}
+}
+
+func TestSearchClient_RetryContext(t *testing.T) {
+	var calls int32
+	// Retry-After на час дольше MaxDelay: FindUsers без дедлайна не ждёт, а сразу возвращает ответ сервера
+	hour := flakyServer(&calls, status(503, "3600"))
+	start := time.Now()
+	_, hourErr := (&SearchClient{AccessToken: "token", URL: hour.URL, Retry: &DefaultRetryPolicy}).FindUsers(SearchRequest{Limit: 1})
+	hour.Close()
+	var hourStatus *HTTPStatusError
+	if !errors.As(hourErr, &hourStatus) || hourStatus.RetryAfter != time.Hour || calls != 1 || time.Since(start) > time.Second {
+		t.Errorf("expected 503 with Retry-After 1h after 1 call, got %v after %d calls in %s", hourErr, calls, time.Since(start))
+	}
+	calls = 0
+
+	ts := flakyServer(&calls, status(503, "1"), status(500, ""), status(500, ""))
+	defer ts.Close()
+	client := &SearchClient{AccessToken: "token", URL: ts.URL, Retry: &RetryPolicy{MaxAttempts: 5, BaseDelay: time.Second}}
+
+	// Retry-After дольше дедлайна - повтора нет, возвращается ответ сервера
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	_, err := client.FindUsersContext(ctx, SearchRequest{Limit: 1})
+	cancel()
+	var status *HTTPStatusError
+	if !errors.As(err, &status) || status.Code != 503 || status.RetryAfter != time.Second || calls != 1 {
+		t.Errorf("expected 503 with Retry-After after 1 call, got %v after %d", err, calls)
+	}
+
+	// отмена во время ожидания перед повтором
+	ctx, cancel = context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_, err = client.FindUsersContext(ctx, SearchRequest{Limit: 1})
+	if !errors.Is(err, context.Canceled) || calls != 2 {
+		t.Errorf("expected canceled after 2 calls, got %v after %d", err, calls)
+	}
+
+	// по умолчанию сетевые ошибки повторяются, Retryable может это запретить
+	ts.Close()
+	var asked int
+	client.Retry = &RetryPolicy{MaxAttempts: 3, Retryable: func(err error) bool { asked++; return false }}
+	if _, err := client.FindUsers(SearchRequest{Limit: 1}); err == nil || asked != 1 {
+		t.Errorf("expected connection error without retries, got %v after %d", err, asked)
+	}
+
+	// отказ в соединении повторяется, неизвестная схема URL - нет
+	client.Retry = &RetryPolicy{MaxAttempts: 2, BaseDelay: 200 * time.Millisecond}
+	start = time.Now()
+	if _, err := client.FindUsers(SearchRequest{Limit: 1}); err == nil || time.Since(start) < 200*time.Millisecond {
+		t.Errorf("expected connection error after a retry, got %v in %s", err, time.Since(start))
+	}
+	client.URL = "bad://" + strings.TrimPrefix(ts.URL, "http://")
+	start = time.Now()
+	_, err = client.FindUsers(SearchRequest{Limit: 1})
+	if err == nil || DefaultRetryPolicy.retryable(err) || time.Since(start) > 100*time.Millisecond {
+		t.Errorf("expected unsupported scheme without retries, got %v in %s", err, time.Since(start))
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for attempt, want := range []time.Duration{100, 200, 300, 300} {
+		if got := p.backoff(attempt + 1); got != want*time.Millisecond {
+			t.Errorf("attempt %d: got %s, want %dms", attempt+1, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := p.backoff(2); got < 100*time.Millisecond || got > 200*time.Millisecond {
+			t.Fatalf("jittered delay %s out of [100ms, 200ms]", got)
+		}
+	}
+
+	if _, ok := DefaultRetryPolicy.next(context.Background(), 1, &BadOrderFieldError{}); ok {
+		t.Error("bad order field must not be retried")
+	}
+	if _, ok := DefaultRetryPolicy.next(context.Background(), 1, fmt.Errorf("wrapped: %w", context.DeadlineExceeded)); ok {
+		t.Error("context errors must not be retried")
+	}
+	if delay, ok := DefaultRetryPolicy.next(context.Background(), 1, &TimeoutError{}); !ok || delay > DefaultRetryPolicy.BaseDelay {
+		t.Errorf("timeout must be retried after base delay, got %s %v", delay, ok)
+	}
+
+	// Retry-After не дольше MaxDelay заменяет задержку, более долгий - прекращает повторы
+	for _, tt := range []struct {
+		maxDelay, retryAfter, want time.Duration
+		ok                         bool
+	}{
+		{2 * time.Second, time.Second, time.Second, true},
+		{2 * time.Second, time.Hour, 0, false},
+		{0, DefaultRetryPolicy.MaxDelay, DefaultRetryPolicy.MaxDelay, true},
+		{0, time.Hour, 0, false},
+	} {
+		p := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: tt.maxDelay}
+		delay, ok := p.next(context.Background(), 1, &HTTPStatusError{Code: http.StatusServiceUnavailable, RetryAfter: tt.retryAfter})
+		if delay != tt.want || ok != tt.ok {
+			t.Errorf("max delay %s, Retry-After %s: got %s %v, want %s %v", tt.maxDelay, tt.retryAfter, delay, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		code  int
+		value string
+		want  time.Duration
+	}{
+		{http.StatusTooManyRequests, "3", 3 * time.Second},
+		{http.StatusServiceUnavailable, now.Add(time.Minute).Format(http.TimeFormat), time.Minute},
+		{http.StatusServiceUnavailable, now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{http.StatusServiceUnavailable, "soon", 0},
+		{http.StatusServiceUnavailable, "", 0},
+		{http.StatusInternalServerError, "3", 0},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{StatusCode: tt.code, Header: http.Header{}}
+		if tt.value != "" {
+			resp.Header.Set("Retry-After", tt.value)
+		}
+		if got := retryAfter(resp, now); got != tt.want {
+			t.Errorf("%d %q: got %s, want %s", tt.code, tt.value, got, tt.want)
+		}
+	}
+}
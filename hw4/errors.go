@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Ошибки FindUsers. Проверяются через errors.Is и errors.As, а не по тексту
+var (
+	ErrBadLimit       = errors.New("limit must be > 0")
+	ErrBadOffset      = errors.New("offset must be > 0")
+	ErrBadAccessToken = errors.New("Bad AccessToken")
+	ErrServerFatal    = errors.New("SearchServer fatal error")
+)
+
+// BadOrderFieldError - сервер не умеет сортировать по Field.
+// errors.Is(err, &BadOrderFieldError{Field: "X"}) сравнивает поле
+type BadOrderFieldError struct {
+	Field string
+}
+
+func (e *BadOrderFieldError) Error() string {
+	return fmt.Sprintf("OrderField %s invalid", e.Field)
+}
+
+func (e *BadOrderFieldError) Is(target error) bool {
+	t, ok := target.(*BadOrderFieldError)
+	return ok && t.Field == e.Field
+}
+
+// TimeoutError - сервер не ответил за таймаут http-клиента. Истёкший дедлайн контекста
+// вызывающего - не TimeoutError, а ошибка с context.DeadlineExceeded внутри
+type TimeoutError struct {
+	Params string
+}
+
+func (e *TimeoutError) Error() string {
+	return "timeout for " + e.Params
+}
+
+func (e *TimeoutError) Timeout() bool {
+	return true
+}
+
+// HTTPStatusError - неуспешный ответ сервера. Для 401 и 500 Unwrap возвращает
+// ErrBadAccessToken и ErrServerFatal, Body - тело ответа или текст ошибки из него
+type HTTPStatusError struct {
+	Code int
+	Body string
+	// RetryAfter - через сколько сервер просит повторить запрос (заголовок Retry-After у 429 и 503), 0 - не просит
+	RetryAfter time.Duration
+	err        error
+}
+
+func (e *HTTPStatusError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("%s (status %d)", e.err, e.Code)
+	}
+	return fmt.Sprintf("SearchServer status %d: %s", e.Code, e.Body)
+}
+
+func (e *HTTPStatusError) Unwrap() error {
+	return e.err
+}
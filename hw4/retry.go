@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy - когда и через сколько повторять FindUsers.
+// Задержка перед n-м повтором - BaseDelay * 2^(n-1), не больше MaxDelay, и уменьшается на случайную долю до Jitter,
+// чтобы клиенты не повторяли запросы одновременно. Retry-After в ответах 429 и 503 заменяет эту задержку,
+// но если он дольше MaxDelay (при MaxDelay <= 0 - дольше DefaultRetryPolicy.MaxDelay), повтора нет:
+// возвращается ошибка с RetryAfter, и ждать ли так долго, решает вызывающий.
+// Если следующая попытка не успевает до дедлайна ctx, FindUsersContext сразу возвращает последнюю ошибку
+type RetryPolicy struct {
+	// MaxAttempts - всего попыток вместе с первой
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	// Jitter в [0, 1]
+	Jitter float64
+	// Statuses - коды ответа, после которых запрос повторяется, nil - DefaultRetryStatuses
+	Statuses []int
+	// Retryable решает, повторять ли запрос после ошибки без ответа сервера, nil - таймауты и ошибки соединения.
+	// Отмена и дедлайн ctx не повторяются никогда
+	Retryable func(err error) bool
+}
+
+var DefaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultRetryPolicy - 3 попытки с задержками около 100 и 200 мс
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   100 * time.Millisecond,
+	MaxDelay:    2 * time.Second,
+	Jitter:      0.2,
+}
+
+// retryableError - по умолчанию повторяются таймауты и ошибки соединения: отказ, сброс, обрыв ответа,
+// ошибки DNS и сокетов (*net.OpError). Остальные ошибки транспорта, например неизвестная схема URL
+// или неверный сертификат, повтором не исправить. *url.Error реализует net.Error, поэтому
+// проверять его просто через net.Error нельзя - так повторялось бы всё подряд
+func retryableError(err error) bool {
+	var timeout *TimeoutError
+	var netErr net.Error
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &timeout), errors.As(err, &netErr) && netErr.Timeout(), errors.As(err, &opErr):
+		return true
+	}
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var status *HTTPStatusError
+	if errors.As(err, &status) {
+		statuses := p.Statuses
+		if statuses == nil {
+			statuses = DefaultRetryStatuses
+		}
+		for _, code := range statuses {
+			if code == status.Code {
+				return true
+			}
+		}
+		return false
+	}
+
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return retryableError(err)
+}
+
+// next - задержка перед попыткой attempt+1 после ошибки err, false - больше не повторять,
+// в том числе если дедлайн ctx наступит раньше, чем пройдёт задержка
+func (p *RetryPolicy) next(ctx context.Context, attempt int, err error) (time.Duration, bool) {
+	if p == nil || attempt >= p.MaxAttempts || !p.retryable(err) {
+		return 0, false
+	}
+
+	delay := p.backoff(attempt)
+	var status *HTTPStatusError
+	if errors.As(err, &status) && status.RetryAfter > 0 {
+		limit := p.MaxDelay
+		if limit <= 0 {
+			limit = DefaultRetryPolicy.MaxDelay
+		}
+		if status.RetryAfter > limit {
+			return 0, false
+		}
+		delay = status.RetryAfter
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+		return 0, false
+	}
+	return delay, true
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < attempt && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(rand.Float64() * p.Jitter * float64(delay))
+	}
+	return delay
+}
+
+// sleepContext ждёт delay или отмены ctx
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("retry in %s: %w", delay, ctx.Err())
+	case <-timer.C:
+		return nil
+	}
+}
+
+// retryAfter разбирает Retry-After у ответов 429 и 503: число секунд или дата
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return 0
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}